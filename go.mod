@@ -2,4 +2,12 @@ module github.com/c-sto/gogitdumper
 
 go 1.19
 
-require golang.org/x/net v0.2.0
+require (
+	golang.org/x/net v0.10.0
+	software.sslmate.com/src/go-pkcs12 v0.4.0
+)
+
+require (
+	golang.org/x/crypto v0.11.0 // indirect
+	golang.org/x/text v0.11.0 // indirect
+)
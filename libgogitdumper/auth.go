@@ -0,0 +1,279 @@
+package libgogitdumper
+
+import (
+	"crypto/md5"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"hash"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+)
+
+// HeaderTransport adds the same headers to every request to the target hosts, and the User-Agent to every request.
+// A Host header sets the request's Host instead. Redirects off to other hosts don't get the headers, since they could hold credentials.
+type HeaderTransport struct {
+	Next      http.RoundTripper
+	Header    http.Header
+	UserAgent string
+	Hosts     map[string]bool //the hosts that get the headers
+}
+
+// NewHeaderTransport wraps next, parsing headers in the "Name: value" form. Only requests to the hosts in targets (urls) get them.
+func NewHeaderTransport(next http.RoundTripper, headers []string, userAgent string, targets []string) (*HeaderTransport, error) {
+	h := &HeaderTransport{Next: next, Header: http.Header{}, UserAgent: userAgent, Hosts: targetHosts(targets)}
+	for _, x := range headers {
+		name, value, ok := strings.Cut(x, ":")
+		if !ok || strings.TrimSpace(name) == "" {
+			return nil, fmt.Errorf("bad header %q, should be in the form \"Name: value\"", x)
+		}
+		h.Header.Add(strings.TrimSpace(name), strings.TrimSpace(value))
+	}
+	return h, nil
+}
+
+func (h *HeaderTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if len(h.Header) == 0 && h.UserAgent == "" {
+		return h.Next.RoundTrip(req)
+	}
+	req = req.Clone(req.Context())
+	if h.UserAgent != "" {
+		req.Header.Set("User-Agent", h.UserAgent)
+	}
+	if !h.Hosts[canonicalHost(req.URL)] {
+		return h.Next.RoundTrip(req)
+	}
+	for k, v := range h.Header {
+		if k == "Host" {
+			req.Host = v[0]
+			continue
+		}
+		req.Header[k] = v
+	}
+	return h.Next.RoundTrip(req)
+}
+
+// AuthTransport adds basic, bearer or digest auth to every request to the target hosts. Digest auth answers the server's 401 challenge,
+// then keeps using that challenge (per host) so later requests don't need the extra round trip.
+// Requests to any other host (like somewhere a target redirects to) go without, so the credentials don't leak.
+type AuthTransport struct {
+	Next     http.RoundTripper
+	Type     string //basic, digest or bearer
+	Username string
+	Password string
+	Token    string
+	Hosts    map[string]bool //the hosts that get the credentials
+
+	mutex      *sync.Mutex
+	challenges map[string]*digestChallenge
+}
+
+// NewAuthTransport wraps next. creds is user:pass for basic and digest, or the token for bearer. Only requests to the hosts in targets (urls) get them.
+func NewAuthTransport(next http.RoundTripper, authType string, creds string, targets []string) (*AuthTransport, error) {
+	a := &AuthTransport{Next: next, Type: strings.ToLower(authType), Hosts: targetHosts(targets), mutex: &sync.Mutex{}, challenges: make(map[string]*digestChallenge)}
+	switch a.Type {
+	case "basic", "digest":
+		user, pass, ok := strings.Cut(creds, ":")
+		if !ok {
+			return nil, fmt.Errorf("%s auth needs credentials in the form user:pass", a.Type)
+		}
+		a.Username, a.Password = user, pass
+	case "bearer":
+		a.Token = creds
+	default:
+		return nil, fmt.Errorf("unknown auth type %q (basic, digest or bearer)", authType)
+	}
+	return a, nil
+}
+
+func (a *AuthTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if !a.Hosts[canonicalHost(req.URL)] {
+		return a.Next.RoundTrip(req)
+	}
+	switch a.Type {
+	case "basic":
+		req = req.Clone(req.Context())
+		req.SetBasicAuth(a.Username, a.Password)
+		return a.Next.RoundTrip(req)
+	case "bearer":
+		req = req.Clone(req.Context())
+		req.Header.Set("Authorization", "Bearer "+a.Token)
+		return a.Next.RoundTrip(req)
+	}
+
+	//digest
+	a.mutex.Lock()
+	c := a.challenges[req.URL.Host]
+	a.mutex.Unlock()
+	first := req
+	if c != nil {
+		first = req.Clone(req.Context())
+		first.Header.Set("Authorization", c.authorize(req, a.Username, a.Password))
+	}
+	resp, err := a.Next.RoundTrip(first)
+	if err != nil || resp.StatusCode != 401 || (req.Body != nil && req.GetBody == nil) {
+		return resp, err
+	}
+	c = parseDigestChallenge(resp.Header.Values("WWW-Authenticate"))
+	if c == nil {
+		return resp, err
+	}
+	resp.Body.Close()
+	a.mutex.Lock()
+	a.challenges[req.URL.Host] = c
+	a.mutex.Unlock()
+
+	retry := req.Clone(req.Context())
+	if req.Body != nil {
+		if retry.Body, err = req.GetBody(); err != nil {
+			return nil, err
+		}
+	}
+	retry.Header.Set("Authorization", c.authorize(req, a.Username, a.Password))
+	return a.Next.RoundTrip(retry)
+}
+
+// targetHosts makes the set of hosts the target urls are on
+func targetHosts(targets []string) map[string]bool {
+	ret := map[string]bool{}
+	for _, x := range targets {
+		if u, err := url.Parse(strings.TrimSpace(x)); err == nil && u.Host != "" {
+			ret[canonicalHost(u)] = true
+		}
+	}
+	return ret
+}
+
+// canonicalHost is the lowercased host:port, with the default port filled in so http://a/ and http://a:80/ match
+func canonicalHost(u *url.URL) string {
+	port := u.Port()
+	if port == "" {
+		port = "80"
+		if strings.EqualFold(u.Scheme, "https") {
+			port = "443"
+		}
+	}
+	return net.JoinHostPort(strings.ToLower(u.Hostname()), port)
+}
+
+type digestChallenge struct {
+	realm     string
+	nonce     string
+	opaque    string
+	algorithm string
+	qop       string //only auth is supported, so this is either "auth" or empty
+	mutex     sync.Mutex
+	nc        uint32
+}
+
+// parseDigestChallenge picks the first Digest challenge we can answer
+func parseDigestChallenge(headers []string) *digestChallenge {
+	for _, h := range headers {
+		scheme, rest, _ := strings.Cut(strings.TrimSpace(h), " ")
+		if !strings.EqualFold(scheme, "Digest") {
+			continue
+		}
+		params := parseAuthParams(rest)
+		c := &digestChallenge{realm: params["realm"], nonce: params["nonce"], opaque: params["opaque"], algorithm: params["algorithm"]}
+		if c.algorithm == "" {
+			c.algorithm = "MD5"
+		}
+		switch strings.ToUpper(c.algorithm) {
+		case "MD5", "MD5-SESS", "SHA-256", "SHA-256-SESS":
+		default:
+			continue
+		}
+		if qop, ok := params["qop"]; ok {
+			for _, x := range strings.Split(qop, ",") {
+				if strings.TrimSpace(x) == "auth" {
+					c.qop = "auth"
+				}
+			}
+			if c.qop == "" {
+				//auth-int only, which would mean hashing every body
+				continue
+			}
+		}
+		return c
+	}
+	return nil
+}
+
+// parseAuthParams splits up key=value, key="quoted, value" pairs
+func parseAuthParams(s string) map[string]string {
+	ret := map[string]string{}
+	for s = strings.TrimSpace(s); s != ""; s = strings.TrimLeft(s, ", ") {
+		key, rest, ok := strings.Cut(s, "=")
+		if !ok {
+			break
+		}
+		key = strings.ToLower(strings.TrimSpace(key))
+		var value string
+		if strings.HasPrefix(rest, `"`) {
+			b := strings.Builder{}
+			i := 1
+			for ; i < len(rest) && rest[i] != '"'; i++ {
+				if rest[i] == '\\' && i+1 < len(rest) {
+					i++
+				}
+				b.WriteByte(rest[i])
+			}
+			value = b.String()
+			if i < len(rest) {
+				i++ //closing quote
+			}
+			s = rest[i:]
+		} else {
+			value, s, _ = strings.Cut(rest, ",")
+			value = strings.TrimSpace(value)
+		}
+		ret[key] = value
+	}
+	return ret
+}
+
+// authorize makes the Authorization header for a request, counting it against the nonce
+func (c *digestChallenge) authorize(req *http.Request, user, pass string) string {
+	c.mutex.Lock()
+	c.nc++
+	nc := fmt.Sprintf("%08x", c.nc)
+	c.mutex.Unlock()
+	return c.header(user, pass, req.Method, req.URL.RequestURI(), nc, randomHex(16))
+}
+
+// header works out the response for one request (RFC 7616 section 3.4.1)
+func (c *digestChallenge) header(user, pass, method, uri, nc, cnonce string) string {
+	var h func() hash.Hash = md5.New
+	if strings.HasPrefix(strings.ToUpper(c.algorithm), "SHA-256") {
+		h = sha256.New
+	}
+	H := func(s string) string {
+		x := h()
+		x.Write([]byte(s))
+		return hex.EncodeToString(x.Sum(nil))
+	}
+
+	ha1 := H(user + ":" + c.realm + ":" + pass)
+	if strings.HasSuffix(strings.ToUpper(c.algorithm), "-SESS") {
+		ha1 = H(ha1 + ":" + c.nonce + ":" + cnonce)
+	}
+	ha2 := H(method + ":" + uri)
+	var response string
+	if c.qop != "" {
+		response = H(ha1 + ":" + c.nonce + ":" + nc + ":" + cnonce + ":" + c.qop + ":" + ha2)
+	} else {
+		response = H(ha1 + ":" + c.nonce + ":" + ha2)
+	}
+
+	ret := fmt.Sprintf(`Digest username="%s", realm="%s", nonce="%s", uri="%s", algorithm=%s, response="%s"`, user, c.realm, c.nonce, uri, c.algorithm, response)
+	if c.qop != "" {
+		ret += fmt.Sprintf(`, qop=%s, nc=%s, cnonce="%s"`, c.qop, nc, cnonce)
+	}
+	if c.opaque != "" {
+		ret += fmt.Sprintf(`, opaque="%s"`, c.opaque)
+	}
+	return ret
+}
@@ -0,0 +1,219 @@
+package libgogitdumper
+
+import (
+	"crypto/md5"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// the example from RFC 7616 section 3.9.1
+const (
+	rfcRealm  = "http-auth@example.org"
+	rfcNonce  = "7ypf/xlj9XXwfDPEoM4URrv/xwf94BcCAzFZH4GiTo0v"
+	rfcOpaque = "FQhe/qaU925kfnzjCev0ciny7QMkPqMAFRtzCUYo5tdS"
+	rfcCnonce = "f2/wE4q74E6zIJEtWaHKaf5wv/H5QzzpXusqGemxURZJ"
+)
+
+var rfcChallenges = []string{
+	`Digest realm="http-auth@example.org", qop="auth, auth-int", algorithm=SHA-256, nonce="7ypf/xlj9XXwfDPEoM4URrv/xwf94BcCAzFZH4GiTo0v", opaque="FQhe/qaU925kfnzjCev0ciny7QMkPqMAFRtzCUYo5tdS"`,
+	`Digest realm="http-auth@example.org", qop="auth, auth-int", algorithm=MD5, nonce="7ypf/xlj9XXwfDPEoM4URrv/xwf94BcCAzFZH4GiTo0v", opaque="FQhe/qaU925kfnzjCev0ciny7QMkPqMAFRtzCUYo5tdS"`,
+}
+
+func TestParseDigestChallenge(t *testing.T) {
+	tests := []struct {
+		name    string
+		headers []string
+		want    *digestChallenge //nil if nothing can be answered
+	}{
+		{"rfc 7616, first usable", rfcChallenges, &digestChallenge{realm: rfcRealm, nonce: rfcNonce, opaque: rfcOpaque, algorithm: "SHA-256", qop: "auth"}},
+		{"rfc 7616, md5", rfcChallenges[1:], &digestChallenge{realm: rfcRealm, nonce: rfcNonce, opaque: rfcOpaque, algorithm: "MD5", qop: "auth"}},
+		{"no algorithm or qop (rfc 2069)", []string{`Digest realm="r", nonce="n"`}, &digestChallenge{realm: "r", nonce: "n", algorithm: "MD5"}},
+		{"quoted commas and escapes", []string{`digest realm="a, \"b\"", nonce=abc, qop=auth`}, &digestChallenge{realm: `a, "b"`, nonce: "abc", algorithm: "MD5", qop: "auth"}},
+		{"after basic", []string{`Basic realm="x"`, `Digest realm="r", nonce="n", algorithm=MD5-sess`}, &digestChallenge{realm: "r", nonce: "n", algorithm: "MD5-sess"}},
+		{"basic only", []string{`Basic realm="x"`}, nil},
+		{"auth-int only", []string{`Digest realm="r", nonce="n", qop="auth-int"`}, nil},
+		{"unknown algorithm", []string{`Digest realm="r", nonce="n", algorithm=SHA-512-256`}, nil},
+		{"nothing", nil, nil},
+	}
+	for _, tt := range tests {
+		got := parseDigestChallenge(tt.headers)
+		if (got == nil) != (tt.want == nil) {
+			t.Errorf("%s: got %+v, want %+v", tt.name, got, tt.want)
+			continue
+		}
+		if got != nil && (got.realm != tt.want.realm || got.nonce != tt.want.nonce || got.opaque != tt.want.opaque || got.algorithm != tt.want.algorithm || got.qop != tt.want.qop) {
+			t.Errorf("%s: got %+v, want %+v", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestDigestRFC7616(t *testing.T) {
+	tests := []struct {
+		algorithm string
+		response  string
+	}{
+		{"MD5", "8ca523f5e9506fed4657c9700eebdbec"},
+		{"SHA-256", "753927fa0e85d155564e2e272a28d1802ca10daf4496794697cf8db5856cb6c1"},
+	}
+	for _, tt := range tests {
+		c := &digestChallenge{realm: rfcRealm, nonce: rfcNonce, opaque: rfcOpaque, algorithm: tt.algorithm, qop: "auth"}
+		got := parseAuthParams(strings.TrimPrefix(c.header("Mufasa", "Circle of Life", "GET", "/dir/index.html", "00000001", rfcCnonce), "Digest "))
+		want := map[string]string{
+			"username": "Mufasa", "realm": rfcRealm, "uri": "/dir/index.html", "algorithm": tt.algorithm, "nonce": rfcNonce,
+			"nc": "00000001", "cnonce": rfcCnonce, "qop": "auth", "response": tt.response, "opaque": rfcOpaque,
+		}
+		for k, v := range want {
+			if got[k] != v {
+				t.Errorf("%s: %s is %q, want %q", tt.algorithm, k, got[k], v)
+			}
+		}
+	}
+}
+
+func md5hex(s string) string {
+	h := md5.Sum([]byte(s))
+	return hex.EncodeToString(h[:])
+}
+
+// digestServer checks MD5/auth digest credentials for user:pass, with its own implementation of the sums
+type digestServer struct {
+	mutex      sync.Mutex
+	challenges int
+	ncs        []string
+}
+
+func (d *digestServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+	p := parseAuthParams(strings.TrimPrefix(r.Header.Get("Authorization"), "Digest "))
+	ha1 := md5hex("user:" + rfcRealm + ":pass")
+	ha2 := md5hex(r.Method + ":" + r.URL.RequestURI())
+	if p["uri"] == r.URL.RequestURI() && p["response"] == md5hex(ha1+":"+rfcNonce+":"+p["nc"]+":"+p["cnonce"]+":auth:"+ha2) {
+		d.ncs = append(d.ncs, p["nc"])
+		fmt.Fprint(w, "ok")
+		return
+	}
+	d.challenges++
+	w.Header().Add("WWW-Authenticate", `Basic realm="nope"`)
+	w.Header().Add("WWW-Authenticate", `Digest realm="`+rfcRealm+`", qop="auth", nonce="`+rfcNonce+`"`)
+	w.WriteHeader(401)
+}
+
+func TestAuthTransportDigest(t *testing.T) {
+	d := &digestServer{}
+	ts := httptest.NewServer(d)
+	defer ts.Close()
+
+	a, err := NewAuthTransport(ts.Client().Transport, "digest", "user:pass", []string{ts.URL})
+	if err != nil {
+		t.Fatal(err)
+	}
+	client := &http.Client{Transport: a}
+	for _, path := range []string{"/.git/HEAD", "/.git/config?x=1", "/.git/index"} {
+		resp, err := client.Get(ts.URL + path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		if resp.StatusCode != 200 {
+			t.Errorf("%s: got %d", path, resp.StatusCode)
+		}
+	}
+	//only the first request gets challenged, after that the nonce is reused with the count going up
+	if d.challenges != 1 {
+		t.Errorf("challenged %d times, want 1", d.challenges)
+	}
+	if strings.Join(d.ncs, ",") != "00000001,00000002,00000003" {
+		t.Errorf("got nonce counts %q", d.ncs)
+	}
+
+	d.challenges = 0
+	wrong, _ := NewAuthTransport(ts.Client().Transport, "digest", "user:wrong", []string{ts.URL})
+	resp, err := (&http.Client{Transport: wrong}).Get(ts.URL + "/.git/HEAD")
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != 401 || d.challenges != 2 {
+		t.Errorf("wrong password: got %d after %d challenges, want one retry then the 401", resp.StatusCode, d.challenges)
+	}
+}
+
+func TestAuthTransportHosts(t *testing.T) {
+	var mutex sync.Mutex
+	seen := map[string]http.Header{}
+	record := func(name string) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			mutex.Lock()
+			seen[name] = r.Header.Clone()
+			mutex.Unlock()
+		})
+	}
+	other := httptest.NewServer(record("other"))
+	defer other.Close()
+	target := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		record("target").ServeHTTP(w, r)
+		http.Redirect(w, r, other.URL+"/elsewhere", http.StatusFound)
+	}))
+	defer target.Close()
+
+	tests := []struct {
+		authType string
+		creds    string
+		want     string
+	}{
+		{"basic", "user:pass", "Basic dXNlcjpwYXNz"},
+		{"bearer", "tok", "Bearer tok"},
+	}
+	for _, tt := range tests {
+		seen = map[string]http.Header{}
+		var transport http.RoundTripper = http.DefaultTransport
+		transport, err := NewAuthTransport(transport, tt.authType, tt.creds, []string{target.URL + "/.git/"})
+		if err != nil {
+			t.Fatal(err)
+		}
+		transport, err = NewHeaderTransport(transport, []string{"X-Secret: 1"}, "dumper/1.0", []string{target.URL + "/.git/"})
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp, err := (&http.Client{Transport: transport}).Get(target.URL + "/.git/HEAD")
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+
+		if got := seen["target"].Get("Authorization"); got != tt.want {
+			t.Errorf("%s: target got Authorization %q, want %q", tt.authType, got, tt.want)
+		}
+		if seen["target"].Get("X-Secret") != "1" {
+			t.Errorf("%s: target didn't get the extra header", tt.authType)
+		}
+		if seen["other"] == nil {
+			t.Fatalf("%s: redirect not followed", tt.authType)
+		}
+		if seen["other"].Get("Authorization") != "" || seen["other"].Get("X-Secret") != "" {
+			t.Errorf("%s: redirect target got the credentials: %v", tt.authType, seen["other"])
+		}
+		//the user agent isn't a secret, so it goes everywhere
+		if seen["other"].Get("User-Agent") != "dumper/1.0" {
+			t.Errorf("%s: redirect target got User-Agent %q", tt.authType, seen["other"].Get("User-Agent"))
+		}
+	}
+}
+
+func TestCanonicalHost(t *testing.T) {
+	hosts := targetHosts([]string{"http://Example.com/.git/", "https://example.com:8443/x", "not a url", "http://[::1]/"})
+	for _, x := range []string{"example.com:80", "example.com:8443", "[::1]:80"} {
+		if !hosts[x] {
+			t.Errorf("%s missing from %v", x, hosts)
+		}
+	}
+	if len(hosts) != 3 {
+		t.Errorf("got %v", hosts)
+	}
+}
@@ -0,0 +1,179 @@
+package libgogitdumper
+
+import (
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// ErrNotBucket is returned when none of the bucket listing apis work on a url
+var ErrNotBucket = errors.New("not a listable bucket")
+
+// maxBucketPages caps how many pages of a listing get requested, in case the server never stops saying there's more
+const maxBucketPages = 1000
+
+// s3ListResult covers both S3 ListObjects v1 and v2, and GCS's XML api (which copies S3)
+type s3ListResult struct {
+	XMLName               xml.Name `xml:"ListBucketResult"`
+	IsTruncated           bool
+	NextContinuationToken string
+	NextMarker            string
+	Contents              []struct {
+		Key string
+	}
+}
+
+type azureListResult struct {
+	XMLName xml.Name `xml:"EnumerationResults"`
+	Blobs   struct {
+		Blob []struct {
+			Name string
+		}
+	}
+	NextMarker string
+}
+
+// FindBucketListing works out if a .git/ url lives in a publicly listable S3/GCS/Azure bucket, and returns the url of every object under it if so.
+// The bucket could be virtual-hosted (bucket.s3.amazonaws.com/.git/) or path style (s3.amazonaws.com/bucket/.git/), so every split of the path is tried.
+func FindBucketListing(gitURL string, client *http.Client) ([]string, error) {
+	u, err := url.Parse(gitURL)
+	if err != nil {
+		return nil, err
+	}
+	segs := strings.Split(strings.Trim(u.Path, "/"), "/")
+	for i := 0; i < len(segs); i++ {
+		root := *u
+		root.Path = "/" + strings.Join(segs[:i], "/")
+		if i > 0 {
+			root.Path += "/"
+		}
+		root.RawQuery = ""
+		prefix := strings.Join(segs[i:], "/") + "/"
+
+		keys, err := ListBucket(root.String(), prefix, client)
+		if err != nil || len(keys) == 0 {
+			continue
+		}
+		ret := []string{}
+		for _, k := range keys {
+			if !strings.HasPrefix(k, prefix) || strings.HasSuffix(k, "/") {
+				//folder placeholder objects, or something the server shouldn't have given us
+				continue
+			}
+			ret = append(ret, gitURL+escapeKey(k[len(prefix):]))
+		}
+		return ret, nil
+	}
+	return nil, ErrNotBucket
+}
+
+// ListBucket pages through a bucket listing (S3/GCS style first, then Azure) and returns every key starting with prefix
+func ListBucket(bucketURL string, prefix string, client *http.Client) ([]string, error) {
+	keys, err := listS3(bucketURL, prefix, client)
+	if err == nil {
+		return keys, nil
+	}
+	return listAzure(bucketURL, prefix, client)
+}
+
+func listS3(bucketURL string, prefix string, client *http.Client) ([]string, error) {
+	keys := []string{}
+	token := ""
+	marker := ""
+	seen := map[string]bool{}
+	for page := 1; ; page++ {
+		q := url.Values{}
+		q.Set("list-type", "2")
+		q.Set("prefix", prefix)
+		if token != "" {
+			q.Set("continuation-token", token)
+		}
+		if marker != "" {
+			q.Set("marker", marker)
+		}
+		body, err := GetThing(bucketURL+"?"+q.Encode(), client)
+		if err != nil {
+			return nil, err
+		}
+		res := s3ListResult{}
+		if err := xml.Unmarshal(body, &res); err != nil {
+			return nil, err
+		}
+		for _, x := range res.Contents {
+			keys = append(keys, x.Key)
+		}
+		if !res.IsTruncated || len(res.Contents) == 0 {
+			return keys, nil
+		}
+		//v2 gives a continuation token, v1 (or things that ignore list-type) page on the last key
+		token = res.NextContinuationToken
+		if token == "" {
+			marker = res.NextMarker
+			if marker == "" {
+				marker = res.Contents[len(res.Contents)-1].Key
+			}
+		}
+		//a server that ignores the token/marker would otherwise keep giving us the same page forever
+		if seen[token+"\x00"+marker] {
+			fmt.Printf("Bucket listing gave the same page token twice, stopping at %d keys\n", len(keys))
+			return keys, nil
+		}
+		seen[token+"\x00"+marker] = true
+		if page >= maxBucketPages {
+			fmt.Printf("Bucket listing still truncated after %d pages, stopping at %d keys\n", page, len(keys))
+			return keys, nil
+		}
+		fmt.Printf("Bucket listing truncated at %d keys, getting next page\n", len(keys))
+	}
+}
+
+func listAzure(containerURL string, prefix string, client *http.Client) ([]string, error) {
+	keys := []string{}
+	marker := ""
+	seen := map[string]bool{}
+	for page := 1; ; page++ {
+		q := url.Values{}
+		q.Set("restype", "container")
+		q.Set("comp", "list")
+		q.Set("prefix", prefix)
+		if marker != "" {
+			q.Set("marker", marker)
+		}
+		body, err := GetThing(containerURL+"?"+q.Encode(), client)
+		if err != nil {
+			return nil, err
+		}
+		res := azureListResult{}
+		if err := xml.Unmarshal(body, &res); err != nil {
+			return nil, err
+		}
+		for _, x := range res.Blobs.Blob {
+			keys = append(keys, x.Name)
+		}
+		if res.NextMarker == "" {
+			return keys, nil
+		}
+		if seen[res.NextMarker] {
+			fmt.Printf("Blob listing gave the same marker twice, stopping at %d keys\n", len(keys))
+			return keys, nil
+		}
+		seen[res.NextMarker] = true
+		if page >= maxBucketPages {
+			fmt.Printf("Blob listing still truncated after %d pages, stopping at %d keys\n", page, len(keys))
+			return keys, nil
+		}
+		marker = res.NextMarker
+		fmt.Printf("Blob listing truncated at %d keys, getting next page\n", len(keys))
+	}
+}
+
+func escapeKey(k string) string {
+	segs := strings.Split(k, "/")
+	for i := range segs {
+		segs[i] = url.PathEscape(segs[i])
+	}
+	return strings.Join(segs, "/")
+}
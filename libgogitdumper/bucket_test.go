@@ -0,0 +1,224 @@
+package libgogitdumper
+
+import (
+	"encoding/xml"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"testing"
+)
+
+var bucketKeys = []string{
+	"index.html",
+	"site/.git/HEAD",
+	"site/.git/config",
+	"site/.git/objects/",
+	"site/.git/objects/ab/cdef0123456789abcdef0123456789abcdef01",
+	"site/.git/refs/heads/main",
+	"site/.git/refs/heads/with space",
+	"site/other/.git/HEAD",
+}
+
+// fakeBucket serves bucketKeys, pageSize at a time, the way the given storage api would.
+// Only requests for root are answered, so path style buckets can be tested.
+type fakeBucket struct {
+	kind     string //s3v2, s3v1, gcs or azure
+	root     string
+	pageSize int
+	requests int32
+}
+
+func (b *fakeBucket) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	atomic.AddInt32(&b.requests, 1)
+	q := r.URL.Query()
+	if r.URL.Path != b.root {
+		http.NotFound(w, r)
+		return
+	}
+	if (b.kind == "azure") != (q.Get("comp") == "list") {
+		http.Error(w, "wrong api", 400)
+		return
+	}
+
+	keys := []string{}
+	for _, k := range bucketKeys {
+		if strings.HasPrefix(k, q.Get("prefix")) {
+			keys = append(keys, k)
+		}
+	}
+	sort.Strings(keys)
+
+	//work out where this page starts from the token or marker
+	start := 0
+	switch b.kind {
+	case "s3v2":
+		if tok := q.Get("continuation-token"); tok != "" {
+			start, _ = strconv.Atoi(strings.TrimPrefix(tok, "tok-"))
+		}
+	default:
+		if marker := q.Get("marker"); marker != "" {
+			start = sort.SearchStrings(keys, marker)
+			if start < len(keys) && keys[start] == marker && b.kind != "azure" {
+				start++ //s3 markers are the last key seen, azure's are where to carry on from
+			}
+		}
+	}
+	end := start + b.pageSize
+	if end > len(keys) {
+		end = len(keys)
+	}
+	page := keys[start:end]
+	more := end < len(keys)
+
+	w.Header().Set("Content-Type", "application/xml")
+	if b.kind == "azure" {
+		fmt.Fprint(w, `<?xml version="1.0" encoding="utf-8"?><EnumerationResults><Blobs>`)
+		for _, k := range page {
+			fmt.Fprintf(w, "<Blob><Name>%s</Name></Blob>", xmlEscape(k))
+		}
+		fmt.Fprint(w, "</Blobs><NextMarker>")
+		if more {
+			fmt.Fprint(w, xmlEscape(keys[end]))
+		}
+		fmt.Fprint(w, "</NextMarker></EnumerationResults>")
+		return
+	}
+	fmt.Fprintf(w, `<?xml version="1.0" encoding="UTF-8"?><ListBucketResult><IsTruncated>%v</IsTruncated>`, more)
+	for _, k := range page {
+		fmt.Fprintf(w, "<Contents><Key>%s</Key></Contents>", xmlEscape(k))
+	}
+	if more {
+		switch b.kind {
+		case "s3v2":
+			fmt.Fprintf(w, "<NextContinuationToken>tok-%d</NextContinuationToken>", end)
+		case "gcs":
+			fmt.Fprintf(w, "<NextMarker>%s</NextMarker>", xmlEscape(page[len(page)-1]))
+		}
+		//plain s3v1 only gives NextMarker with a delimiter, so the client has to use the last key
+	}
+	fmt.Fprint(w, "</ListBucketResult>")
+}
+
+func xmlEscape(s string) string {
+	b := &strings.Builder{}
+	xml.EscapeText(b, []byte(s))
+	return b.String()
+}
+
+func TestListBucketPaging(t *testing.T) {
+	want := []string{
+		"site/.git/HEAD",
+		"site/.git/config",
+		"site/.git/objects/",
+		"site/.git/objects/ab/cdef0123456789abcdef0123456789abcdef01",
+		"site/.git/refs/heads/main",
+		"site/.git/refs/heads/with space",
+	}
+	for _, kind := range []string{"s3v2", "s3v1", "gcs", "azure"} {
+		for _, pageSize := range []int{1, 2, 100} {
+			t.Run(fmt.Sprintf("%s/%d", kind, pageSize), func(t *testing.T) {
+				b := &fakeBucket{kind: kind, root: "/", pageSize: pageSize}
+				ts := httptest.NewServer(b)
+				defer ts.Close()
+
+				keys, err := ListBucket(ts.URL+"/", "site/.git/", ts.Client())
+				if err != nil {
+					t.Fatal(err)
+				}
+				sort.Strings(keys)
+				if !reflect.DeepEqual(keys, want) {
+					t.Errorf("got %q, want %q", keys, want)
+				}
+			})
+		}
+	}
+}
+
+func TestFindBucketListing(t *testing.T) {
+	for _, kind := range []string{"s3v2", "s3v1", "gcs", "azure"} {
+		for _, root := range []string{"/", "/bucket/"} {
+			t.Run(kind+root, func(t *testing.T) {
+				b := &fakeBucket{kind: kind, root: root, pageSize: 2}
+				ts := httptest.NewServer(b)
+				defer ts.Close()
+
+				gitURL := ts.URL + root + "site/.git/"
+				got, err := FindBucketListing(gitURL, ts.Client())
+				if err != nil {
+					t.Fatal(err)
+				}
+				sort.Strings(got)
+				//the folder placeholder and anything outside of the .git dir are dropped, and keys are escaped back into urls
+				want := []string{
+					gitURL + "HEAD",
+					gitURL + "config",
+					gitURL + "objects/ab/cdef0123456789abcdef0123456789abcdef01",
+					gitURL + "refs/heads/main",
+					gitURL + "refs/heads/with%20space",
+				}
+				if !reflect.DeepEqual(got, want) {
+					t.Errorf("got %q, want %q", got, want)
+				}
+			})
+		}
+	}
+}
+
+func TestFindBucketListingNotBucket(t *testing.T) {
+	ts := httptest.NewServer(http.NotFoundHandler())
+	defer ts.Close()
+	if _, err := FindBucketListing(ts.URL+"/site/.git/", ts.Client()); err != ErrNotBucket {
+		t.Errorf("got %v, want ErrNotBucket", err)
+	}
+}
+
+func TestListBucketStopsOnRepeats(t *testing.T) {
+	tests := []struct {
+		name string
+		body string
+		list func(string, string, *http.Client) ([]string, error)
+	}{
+		{"same token", `<ListBucketResult><IsTruncated>true</IsTruncated><NextContinuationToken>again</NextContinuationToken><Contents><Key>a</Key></Contents></ListBucketResult>`, listS3},
+		{"marker ignored", `<ListBucketResult><IsTruncated>true</IsTruncated><Contents><Key>a</Key></Contents></ListBucketResult>`, listS3},
+		{"same azure marker", `<EnumerationResults><Blobs><Blob><Name>a</Name></Blob></Blobs><NextMarker>again</NextMarker></EnumerationResults>`, listAzure},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var requests int32
+			ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				atomic.AddInt32(&requests, 1)
+				fmt.Fprint(w, tt.body)
+			}))
+			defer ts.Close()
+
+			if _, err := tt.list(ts.URL+"/", "", ts.Client()); err != nil {
+				t.Fatal(err)
+			}
+			if n := atomic.LoadInt32(&requests); n > 3 {
+				t.Errorf("made %d requests for a listing that repeats itself", n)
+			}
+		})
+	}
+}
+
+func TestListBucketPageCap(t *testing.T) {
+	var requests int32
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		n := atomic.AddInt32(&requests, 1)
+		fmt.Fprintf(w, `<ListBucketResult><IsTruncated>true</IsTruncated><NextContinuationToken>tok-%d</NextContinuationToken><Contents><Key>k%d</Key></Contents></ListBucketResult>`, n, n)
+	}))
+	defer ts.Close()
+
+	keys, err := listS3(ts.URL+"/", "", ts.Client())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n := atomic.LoadInt32(&requests); n != maxBucketPages || len(keys) != maxBucketPages {
+		t.Errorf("made %d requests and got %d keys, want %d of each", n, len(keys), maxBucketPages)
+	}
+}
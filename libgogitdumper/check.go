@@ -0,0 +1,55 @@
+package libgogitdumper
+
+import (
+	"net/http"
+	"regexp"
+)
+
+// CheckResult is the outcome of a quick exposure check. Everything is validated by what the file looks like, not the status code.
+type CheckResult struct {
+	URL          string `json:"url"`
+	Exposed      bool   `json:"exposed"`
+	Head         bool   `json:"head"`
+	Config       bool   `json:"config"`
+	Index        bool   `json:"index"`
+	IndexEntries int    `json:"index_entries"`
+	Packed       bool   `json:"packed"`
+	Packs        int    `json:"packs"`
+	Listing      bool   `json:"listing"`
+	Reflog       bool   `json:"reflog"`
+	Error        string `json:"error,omitempty"`
+}
+
+var configCoreRe = regexp.MustCompile(`(?m)^\s*\[core\]`)
+var packsLineRe = regexp.MustCompile(`(?m)^P pack-[0-9a-fA-F]{40}\.pack\s*$`)
+
+// CheckExposure requests only HEAD, config, index, objects/info/packs, the root listing and logs/HEAD, and reports what's there
+func CheckExposure(gitURL string, client *http.Client) CheckResult {
+	ret := CheckResult{URL: gitURL}
+
+	if b, err := GetThing(gitURL+"HEAD", client); err == nil {
+		ret.Head = ValidHead(b)
+	}
+	if b, err := GetThing(gitURL+"config", client); err == nil {
+		ret.Config = configCoreRe.Match(b)
+	}
+	if b, err := GetThing(gitURL+"index", client); err == nil {
+		if indx, err := ParseIndexFile(b); err == nil {
+			ret.Index = true
+			ret.IndexEntries = len(indx.Entries)
+		}
+	}
+	if b, err := GetThing(gitURL+"objects/info/packs", client); err == nil {
+		ret.Packs = len(packsLineRe.FindAll(b, -1))
+		ret.Packed = ret.Packs > 0
+	}
+	if b, err := GetThing(gitURL, client); err == nil {
+		ret.Listing = DetectListing(b) != nil
+	}
+	if b, err := GetThing(gitURL+"logs/HEAD", client); err == nil {
+		ret.Reflog = len(ParseReflog(b)) > 0
+	}
+
+	ret.Exposed = ret.Head || ret.Config || ret.Index || ret.Packed || ret.Listing || ret.Reflog
+	return ret
+}
@@ -0,0 +1,61 @@
+package libgogitdumper
+
+import (
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+)
+
+const cookiesTxt = "# Netscape HTTP Cookie File\r\n" +
+	"\n" +
+	".example.com\tTRUE\t/\tFALSE\t0\tsession\tabc\n" +
+	"example.com\tFALSE\t/\tFALSE\t0\thostonly\t1\n" +
+	"example.com\tFALSE\t/\tTRUE\t0\tsecure\t2\n" +
+	"example.com\tFALSE\t/app/\tFALSE\t0\tscoped\t3\n" +
+	"#HttpOnly_example.com\tFALSE\t/\tFALSE\t4102444800\thttponly\t4\n" +
+	"example.com\tFALSE\t/\tFALSE\t946684800\texpired\t5\n"
+
+func TestLoadCookieJar(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "cookies.txt")
+	os.WriteFile(path, []byte(cookiesTxt), 0644)
+	jar, err := LoadCookieJar(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		url  string
+		want string
+	}{
+		{"http://example.com/.git/HEAD", "hostonly httponly session"},
+		{"https://example.com/.git/HEAD", "hostonly httponly secure session"},
+		{"http://example.com/app/.git/HEAD", "hostonly httponly scoped session"},
+		{"http://www.example.com/.git/HEAD", "session"}, //only the one that includes subdomains
+		{"http://example.org/.git/HEAD", ""},
+	}
+	for _, tt := range tests {
+		u, _ := url.Parse(tt.url)
+		var names []string
+		for _, c := range jar.Cookies(u) {
+			names = append(names, c.Name)
+		}
+		sort.Strings(names)
+		if got := strings.Join(names, " "); got != tt.want {
+			t.Errorf("%s: got %q, want %q", tt.url, got, tt.want)
+		}
+	}
+}
+
+func TestLoadCookieJarBad(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "cookies.txt")
+	os.WriteFile(path, []byte("# comment\nexample.com TRUE / FALSE 0 name value\n"), 0644)
+	if _, err := LoadCookieJar(path); err == nil || !strings.Contains(err.Error(), ":2:") {
+		t.Errorf("got %v, want an error for line 2", err)
+	}
+	if _, err := LoadCookieJar(filepath.Join(t.TempDir(), "missing")); err == nil {
+		t.Error("no error for a missing file")
+	}
+}
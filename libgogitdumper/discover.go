@@ -0,0 +1,187 @@
+package libgogitdumper
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// ErrNoGitDir is returned when discovery can't find a .git dir anywhere above the url
+var ErrNoGitDir = errors.New("could not find a .git directory")
+
+// ErrUnreachable is returned when discovery can't connect to the host at all, as opposed to the host not having a .git dir
+var ErrUnreachable = errors.New("host unreachable")
+
+var headRefRe = []byte("ref: refs/")
+
+// ValidHead checks that a HEAD file looks like a HEAD file (a symref, or a detached hash)
+func ValidHead(b []byte) bool {
+	b = bytes.TrimSpace(b)
+	return bytes.HasPrefix(b, headRefRe) || sha1Re.Match(b)
+}
+
+// DiscoverGitURL finds the .git/ directory for any url on a site. It checks the url itself (if it's already a .git dir),
+// then .git/HEAD under the url (in case it's a directory missing its trailing slash), in the url's directory and every parent.
+// A .git *file* (worktrees and submodules) gets followed to wherever its gitdir: points.
+// The returned url always has a trailing slash. If the host can't be connected to, discovery stops there with ErrUnreachable.
+func DiscoverGitURL(rawURL string, client *http.Client) (string, error) {
+	u, err := url.Parse(strings.TrimSpace(rawURL))
+	if err != nil {
+		return "", err
+	}
+	if u.Scheme == "" || u.Host == "" {
+		return "", fmt.Errorf("%s is not an absolute url", rawURL)
+	}
+	u.RawQuery = ""
+	u.Fragment = ""
+	if u.Path == "" {
+		u.Path = "/"
+	}
+
+	//already pointing at the .git dir (with or without the slash)
+	if strings.HasSuffix(strings.TrimSuffix(u.Path, "/"), ".git") {
+		gitdir := *u
+		gitdir.Path = strings.TrimSuffix(u.Path, "/") + "/"
+		if ok, err := isGitDir(gitdir.String(), client); err != nil {
+			return "", err
+		} else if ok {
+			return gitdir.String(), nil
+		}
+	}
+
+	dir := u.Path[:strings.LastIndex(u.Path, "/")+1]
+	if dir != u.Path && !strings.HasSuffix(u.Path, "/.git") {
+		//could be a directory without its trailing slash (http://host/repo), so look inside it first
+		dir = u.Path + "/"
+	}
+	for {
+		candidate := *u
+		candidate.Path = dir + ".git/"
+		if ok, err := isGitDir(candidate.String(), client); err != nil {
+			return "", err
+		} else if ok {
+			return candidate.String(), nil
+		}
+
+		//worktrees and submodules have a .git file pointing at the real gitdir
+		candidate.Path = dir + ".git"
+		if gitdir, err := followGitFile(candidate.String(), client); gitdir != "" || err != nil {
+			return gitdir, err
+		}
+
+		if dir == "/" {
+			break
+		}
+		dir = dir[:strings.LastIndex(strings.TrimSuffix(dir, "/"), "/")+1]
+	}
+	return "", ErrNoGitDir
+}
+
+// CandidateGitURL guesses where the .git/ dir for a url would be without making any requests: the url itself if it's a .git dir,
+// otherwise .git/ inside it. A last segment that looks like a file (has an extension) is swapped for .git/ instead.
+func CandidateGitURL(rawURL string) (string, error) {
+	u, err := url.Parse(strings.TrimSpace(rawURL))
+	if err != nil {
+		return "", err
+	}
+	if u.Scheme == "" || u.Host == "" {
+		return "", fmt.Errorf("%s is not an absolute url", rawURL)
+	}
+	u.RawQuery = ""
+	u.Fragment = ""
+	if u.Path == "" {
+		u.Path = "/"
+	}
+	p := u.Path
+	last := p[strings.LastIndex(p, "/")+1:]
+	switch {
+	case strings.HasSuffix(strings.TrimSuffix(p, "/"), "/.git"):
+		u.Path = strings.TrimSuffix(p, "/") + "/"
+	case last == "":
+		u.Path = p + ".git/"
+	case strings.Contains(last, "."):
+		u.Path = p[:len(p)-len(last)] + ".git/"
+	default:
+		u.Path = p + "/.git/"
+	}
+	return u.String(), nil
+}
+
+// isGitDir checks for a valid HEAD in gitdir. The error is only set if the host couldn't be reached, a missing HEAD is just false.
+func isGitDir(gitdir string, client *http.Client) (bool, error) {
+	head, err := GetThing(gitdir+"HEAD", client)
+	if connectionError(err) {
+		return false, fmt.Errorf("%w: %v", ErrUnreachable, err)
+	}
+	return err == nil && ValidHead(head), nil
+}
+
+// connectionError is true if the request never got a response: refused, timed out, dns failures, or no proxies left to go through
+func connectionError(err error) bool {
+	var oe *net.OpError
+	var ne net.Error
+	return errors.As(err, &oe) || (errors.As(err, &ne) && ne.Timeout()) || errors.Is(err, ErrNoProxies)
+}
+
+// followGitFile reads a "gitdir: <path>" file and checks the dir it points to. Only relative paths can be mapped back onto the web server.
+// An empty url means there wasn't a usable .git file.
+func followGitFile(gitfile string, client *http.Client) (string, error) {
+	b, err := GetThing(gitfile, client)
+	if connectionError(err) {
+		return "", fmt.Errorf("%w: %v", ErrUnreachable, err)
+	}
+	if err != nil || !bytes.HasPrefix(b, []byte("gitdir: ")) {
+		return "", nil
+	}
+	target := strings.TrimSpace(string(b[len("gitdir: "):]))
+	if strings.HasPrefix(target, "/") || (len(target) > 1 && target[1] == ':') {
+		fmt.Println("Found a .git file pointing at an absolute path, can't map it to a url: ", target)
+		return "", nil
+	}
+	base, err := url.Parse(gitfile)
+	if err != nil {
+		return "", nil
+	}
+	ref, err := url.Parse(strings.TrimSuffix(target, "/") + "/")
+	if err != nil {
+		return "", nil
+	}
+	gitdir := base.ResolveReference(ref).String()
+	if ok, err := isGitDir(gitdir, client); !ok {
+		return "", err
+	}
+	return gitdir, nil
+}
+
+// CommonDir reads the commondir file of a worktree gitdir (.git/worktrees/<name>/), which points at the main .git dir holding the objects and refs.
+// It returns an error if gitdir isn't a worktree, or the common dir can't be mapped to a url or doesn't look like a .git dir.
+func CommonDir(gitdir string, client *http.Client) (string, error) {
+	b, err := GetThing(gitdir+"commondir", client)
+	if err != nil {
+		return "", err
+	}
+	target := strings.TrimSpace(string(b))
+	if target == "" || strings.Contains(target, "\n") || strings.HasPrefix(target, "/") || (len(target) > 1 && target[1] == ':') {
+		return "", fmt.Errorf("can't map commondir %q to a url", target)
+	}
+	base, err := url.Parse(gitdir)
+	if err != nil {
+		return "", err
+	}
+	ref, err := url.Parse(strings.TrimSuffix(target, "/") + "/")
+	if err != nil {
+		return "", err
+	}
+	common := base.ResolveReference(ref).String()
+	if ok, err := isGitDir(common, client); !ok {
+		if err == nil {
+			err = fmt.Errorf("no HEAD in the commondir %s", common)
+		}
+		return "", err
+	}
+	return common, nil
+}
@@ -0,0 +1,73 @@
+package libgogitdumper
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+// gitSite serves the given files (path -> contents), 404ing everything else
+func gitSite(files map[string]string) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if b, ok := files[r.URL.Path]; ok {
+			w.Write([]byte(b))
+			return
+		}
+		http.NotFound(w, r)
+	}))
+}
+
+func TestDiscoverGitURL(t *testing.T) {
+	ts := gitSite(map[string]string{
+		"/app/.git/HEAD": "ref: refs/heads/main\n",
+	})
+	defer ts.Close()
+
+	for _, start := range []string{"/app/.git", "/app/.git/", "/app", "/app/", "/app/static/js/site.js", "/app/?q=1"} {
+		got, err := DiscoverGitURL(ts.URL+start, ts.Client())
+		if err != nil || got != ts.URL+"/app/.git/" {
+			t.Errorf("%s: got %q %v", start, got, err)
+		}
+	}
+	if _, err := DiscoverGitURL(ts.URL+"/other/", ts.Client()); err != ErrNoGitDir {
+		t.Errorf("got %v, want ErrNoGitDir", err)
+	}
+}
+
+func TestDiscoverGitURLUnreachable(t *testing.T) {
+	ts := gitSite(nil)
+	dead := ts.URL
+	ts.Close()
+
+	if _, err := DiscoverGitURL(dead+"/app/.git/", http.DefaultClient); !errors.Is(err, ErrUnreachable) {
+		t.Errorf("got %v, want ErrUnreachable", err)
+	}
+}
+
+func TestCommonDir(t *testing.T) {
+	ts := gitSite(map[string]string{
+		"/site/.git":                         "gitdir: ../repo/.git/worktrees/wt\n",
+		"/repo/.git/HEAD":                    "ref: refs/heads/main\n",
+		"/repo/.git/worktrees/wt/HEAD":       "ref: refs/heads/feature\n",
+		"/repo/.git/worktrees/wt/commondir":  "../..\n",
+		"/repo/.git/worktrees/abs/HEAD":      "ref: refs/heads/feature\n",
+		"/repo/.git/worktrees/abs/commondir": "/srv/repo/.git\n",
+		"/repo/.git/worktrees/bad/HEAD":      "ref: refs/heads/feature\n",
+		"/repo/.git/worktrees/bad/commondir": "../../../nothing\n",
+	})
+	defer ts.Close()
+
+	gitdir, err := DiscoverGitURL(ts.URL+"/site/", ts.Client())
+	if err != nil || gitdir != ts.URL+"/repo/.git/worktrees/wt/" {
+		t.Fatalf("got %q %v", gitdir, err)
+	}
+	if common, err := CommonDir(gitdir, ts.Client()); err != nil || common != ts.URL+"/repo/.git/" {
+		t.Errorf("got %q %v", common, err)
+	}
+	for _, x := range []string{"/repo/.git/", "/repo/.git/worktrees/abs/", "/repo/.git/worktrees/bad/"} {
+		if common, err := CommonDir(ts.URL+x, ts.Client()); err == nil {
+			t.Errorf("%s: got common dir %q, want an error", x, common)
+		}
+	}
+}
@@ -4,15 +4,21 @@ import (
 	"encoding/binary"
 	"encoding/hex"
 	"errors"
+	"fmt"
 )
 
 func ReadIndex(b []byte) (IndexFile, error) {
 	return IndexFile{}, nil
 }
 
-func ParseIndexFile(b []byte) (IndexFile, error) {
+// ParseIndexFile parses a v2 or v3 index. The offsets all come from the file itself, so a truncated or hostile index is an error rather than a panic.
+func ParseIndexFile(b []byte) (indx IndexFile, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			indx, err = IndexFile{}, fmt.Errorf("Bad index file: %v", r)
+		}
+	}()
 	// thanks to this guy https://github.com/sbp/gin/blob/master/gin
-	indx := IndexFile{}
 	readcount := uint16(0) //easier this way
 	//4 byte signature "DIRC"
 	readcount += 4
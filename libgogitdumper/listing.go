@@ -0,0 +1,324 @@
+package libgogitdumper
+
+import (
+	"bytes"
+	"encoding/json"
+	"encoding/xml"
+	"html"
+	"net/url"
+	"regexp"
+	"strings"
+)
+
+// ListingParser knows how to spot and read one kind of directory listing
+type ListingParser interface {
+	//Detect checks if the response is a listing this parser understands
+	Detect(resp []byte) bool
+	//Parse returns the urls of everything in the listing. Directories have a trailing '/'
+	Parse(resp []byte, baseURL string) []string
+}
+
+// ListingParsers is the registry of known listing formats, tried in order.
+// More specific detectors need to go before the ones that share a title format (lighttpd before apache before nginx).
+var ListingParsers = []ListingParser{
+	PythonListing{},
+	LighttpdListing{},
+	ApacheListing{},
+	NginxListing{},
+	NginxJSONListing{},
+	NginxXMLListing{},
+	CaddyListing{},
+	TomcatListing{},
+	JettyListing{},
+	IISListing{},
+}
+
+// RegisterListingParser adds a parser to the end of the registry
+func RegisterListingParser(p ListingParser) {
+	ListingParsers = append(ListingParsers, p)
+}
+
+// DetectListing returns the first registered parser that recognises the response, or nil if it's not a listing
+func DetectListing(resp []byte) ListingParser {
+	for _, p := range ListingParsers {
+		if p.Detect(resp) {
+			return p
+		}
+	}
+	return nil
+}
+
+var anchorRe = regexp.MustCompile(`(?is)<a\s[^>]*?href=["']([^"']*)["'][^>]*>(.*?)</a>`)
+
+// parseAnchors pulls every link out of an html listing, skipping the ones the skip func doesn't like (parent dirs, sort links etc)
+func parseAnchors(resp []byte, baseURL string, skip func(href, text string) bool) []string {
+	hrefs := []string{}
+	for _, x := range anchorRe.FindAllSubmatch(resp, -1) {
+		href := html.UnescapeString(strings.TrimSpace(string(x[1])))
+		if href == "" || strings.HasPrefix(href, "?") || strings.HasPrefix(href, "#") || skip(href, string(x[2])) {
+			continue
+		}
+		hrefs = append(hrefs, href)
+	}
+	return resolveHrefs(baseURL, hrefs)
+}
+
+// resolveHrefs turns listing links (relative, absolute, or full urls) into full urls using proper url resolution against the listing url.
+// Query strings and fragments are dropped, duplicates are removed, and links back to the directory itself (or any of its parents) are skipped.
+func resolveHrefs(baseURL string, hrefs []string) []string {
+	ret := []string{}
+	base, err := url.Parse(baseURL)
+	if err != nil {
+		return ret
+	}
+	self := base.String()
+	seen := map[string]bool{}
+	for _, x := range hrefs {
+		ref, err := url.Parse(x)
+		if err != nil {
+			continue
+		}
+		abs := base.ResolveReference(ref)
+		abs.RawQuery = ""
+		abs.ForceQuery = false
+		abs.Fragment = ""
+		abs.RawFragment = ""
+		s := abs.String()
+		if seen[s] || (strings.HasSuffix(s, "/") && strings.HasPrefix(self, s)) {
+			continue
+		}
+		seen[s] = true
+		ret = append(ret, s)
+	}
+	return ret
+}
+
+// InGitRoot checks that a url is on the same host as the .git/ root url and underneath it, after decoding any percent-encoding
+func InGitRoot(u string, root string) bool {
+	parsed, err := url.Parse(u)
+	if err != nil {
+		return false
+	}
+	rootParsed, err := url.Parse(root)
+	if err != nil {
+		return false
+	}
+	if parsed.Scheme != rootParsed.Scheme || parsed.Host != rootParsed.Host {
+		return false
+	}
+	rootPath := rootParsed.Path
+	if !strings.HasSuffix(rootPath, "/") {
+		rootPath += "/"
+	}
+	if !strings.HasPrefix(parsed.Path, rootPath) || len(parsed.Path) == len(rootPath) {
+		return false
+	}
+	//encoded dot segments (%2e%2e) survive resolution, but turn back into .. once decoded
+	for _, seg := range strings.Split(parsed.Path[len(rootPath):], "/") {
+		if seg == ".." || seg == "." {
+			return false
+		}
+	}
+	return true
+}
+
+// PythonListing is python's SimpleHTTPServer/http.server
+type PythonListing struct{}
+
+func (PythonListing) Detect(resp []byte) bool {
+	return bytes.Contains(resp, []byte("<title>Directory listing for "))
+}
+
+func (PythonListing) Parse(resp []byte, baseURL string) []string {
+	return parseAnchors(resp, baseURL, func(href, text string) bool { return false })
+}
+
+// ApacheListing is apache mod_autoindex
+type ApacheListing struct{}
+
+func (ApacheListing) Detect(resp []byte) bool {
+	if !bytes.Contains(resp, []byte("<title>Index of /")) {
+		return false
+	}
+	//nginx uses the same title, but doesn't have sort links, a parent directory entry or the server signature
+	return bytes.Contains(resp, []byte("?C=N;O=")) || bytes.Contains(resp, []byte("Parent Directory")) || bytes.Contains(resp, []byte("<address>Apache"))
+}
+
+// Parse skips the column sort links (?C=N;O=D) and the parent directory
+func (ApacheListing) Parse(resp []byte, baseURL string) []string {
+	return parseAnchors(resp, baseURL, func(href, text string) bool {
+		return strings.Contains(text, "Parent Directory")
+	})
+}
+
+// NginxListing is nginx 'autoindex on' with the default html format
+type NginxListing struct{}
+
+func (NginxListing) Detect(resp []byte) bool {
+	return bytes.Contains(resp, []byte("<h1>Index of /")) && bytes.Contains(resp, []byte("<hr><pre>"))
+}
+
+func (NginxListing) Parse(resp []byte, baseURL string) []string {
+	return parseAnchors(resp, baseURL, func(href, text string) bool {
+		return href == "../"
+	})
+}
+
+type nginxJSONEntry struct {
+	Name string `json:"name"`
+	Type string `json:"type"`
+}
+
+// NginxJSONListing is nginx with 'autoindex_format json'
+type NginxJSONListing struct{}
+
+// Detect wants a non empty array where every entry has a name and is a file or directory, since [] and null are valid json too
+func (NginxJSONListing) Detect(resp []byte) bool {
+	entries := []nginxJSONEntry{}
+	if err := json.Unmarshal(resp, &entries); err != nil || len(entries) == 0 {
+		return false
+	}
+	for _, x := range entries {
+		if x.Name == "" || (x.Type != "file" && x.Type != "directory") {
+			return false
+		}
+	}
+	return true
+}
+
+func (NginxJSONListing) Parse(resp []byte, baseURL string) []string {
+	entries := []nginxJSONEntry{}
+	json.Unmarshal(resp, &entries)
+	hrefs := []string{}
+	for _, x := range entries {
+		if x.Type == "directory" {
+			hrefs = append(hrefs, url.PathEscape(x.Name)+"/")
+		} else {
+			hrefs = append(hrefs, url.PathEscape(x.Name))
+		}
+	}
+	return resolveHrefs(baseURL, hrefs)
+}
+
+type nginxXMLList struct {
+	XMLName xml.Name `xml:"list"`
+	Entries []struct {
+		XMLName xml.Name
+		Name    string `xml:",chardata"`
+	} `xml:",any"`
+}
+
+// NginxXMLListing is nginx with 'autoindex_format xml'
+type NginxXMLListing struct{}
+
+func (NginxXMLListing) Detect(resp []byte) bool {
+	if !bytes.Contains(resp, []byte("<list>")) {
+		return false
+	}
+	return xml.Unmarshal(resp, &nginxXMLList{}) == nil
+}
+
+func (NginxXMLListing) Parse(resp []byte, baseURL string) []string {
+	list := nginxXMLList{}
+	xml.Unmarshal(resp, &list)
+	hrefs := []string{}
+	for _, x := range list.Entries {
+		if x.Name == "" {
+			continue
+		}
+		if x.XMLName.Local == "directory" {
+			hrefs = append(hrefs, url.PathEscape(x.Name)+"/")
+		} else {
+			hrefs = append(hrefs, url.PathEscape(x.Name))
+		}
+	}
+	return resolveHrefs(baseURL, hrefs)
+}
+
+// LighttpdListing is lighttpd mod_dirlisting
+type LighttpdListing struct{}
+
+func (LighttpdListing) Detect(resp []byte) bool {
+	return bytes.Contains(resp, []byte(`summary="Directory Listing"`)) || bytes.Contains(resp, []byte(`<div class="foot">lighttpd`))
+}
+
+func (LighttpdListing) Parse(resp []byte, baseURL string) []string {
+	return parseAnchors(resp, baseURL, func(href, text string) bool {
+		return href == "../" || strings.Contains(text, "Parent Directory")
+	})
+}
+
+// CaddyListing is caddy's file_server browse page
+type CaddyListing struct{}
+
+func (CaddyListing) Detect(resp []byte) bool {
+	return bytes.Contains(resp, []byte("caddyserver.com")) && bytes.Contains(resp, []byte("<table"))
+}
+
+func (CaddyListing) Parse(resp []byte, baseURL string) []string {
+	return parseAnchors(resp, baseURL, func(href, text string) bool {
+		//links to caddy itself, the up link and the sort/layout links
+		return strings.Contains(href, "://") || href == "../" || strings.Contains(href, "?")
+	})
+}
+
+// TomcatListing is the tomcat DefaultServlet with listings enabled
+type TomcatListing struct{}
+
+func (TomcatListing) Detect(resp []byte) bool {
+	return bytes.Contains(resp, []byte("<title>Directory Listing For ["))
+}
+
+// Parse skips the 'Up To' link, everything else is an absolute path
+func (TomcatListing) Parse(resp []byte, baseURL string) []string {
+	return parseAnchors(resp, baseURL, func(href, text string) bool {
+		return strings.Contains(text, "Up To [")
+	})
+}
+
+// JettyListing is jetty's DefaultServlet/ResourceHandler listing
+type JettyListing struct{}
+
+var jettyTitleRe = regexp.MustCompile(`(?i)<title>Directory: /`)
+
+func (JettyListing) Detect(resp []byte) bool {
+	return jettyTitleRe.Match(resp)
+}
+
+func (JettyListing) Parse(resp []byte, baseURL string) []string {
+	return parseAnchors(resp, baseURL, func(href, text string) bool {
+		return strings.Contains(text, "Parent Directory")
+	})
+}
+
+// IISListing is IIS/ASP.NET "directory browsing"
+type IISListing struct{}
+
+var brRe = regexp.MustCompile(`(?i)<br\s*/?>`)
+
+func (IISListing) Detect(resp []byte) bool {
+	return bytes.Contains(resp, []byte("[To Parent Directory]")) || (bytes.Contains(bytes.ToLower(resp), []byte("<pre>")) && bytes.Contains(resp, []byte("&lt;dir&gt;")))
+}
+
+// Parse uses the <dir> markers to tell directories from files, so we don't need to request everything to find out.
+// The hrefs are absolute, so they get resolved against the listing url.
+func (IISListing) Parse(resp []byte, baseURL string) []string {
+	hrefs := []string{}
+	//one entry per line, each line is: date time <dir>|size <A HREF="...">name</A>
+	for _, line := range brRe.Split(string(resp), -1) {
+		x := anchorRe.FindStringSubmatch(line)
+		if x == nil || x[1] == "" || strings.Contains(x[2], "[To Parent Directory]") {
+			continue
+		}
+		href := x[1]
+		if strings.Contains(line, "&lt;dir&gt;") {
+			if !strings.HasSuffix(href, "/") {
+				href += "/"
+			}
+		} else {
+			href = strings.TrimSuffix(href, "/")
+		}
+		hrefs = append(hrefs, href)
+	}
+	return resolveHrefs(baseURL, hrefs)
+}
@@ -0,0 +1,148 @@
+package libgogitdumper
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+const listingBase = "http://example.com/.git/objects/"
+
+// the fixtures all list the same directory: two subdirectories and a file with a space in its name
+var listingWant = []string{
+	listingBase + "ab/",
+	listingBase + "pack/",
+	listingBase + "with%20space",
+}
+
+func readFixture(t *testing.T, name string) []byte {
+	t.Helper()
+	b, err := os.ReadFile(filepath.Join("testdata", "listings", name))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return b
+}
+
+func TestListingParsers(t *testing.T) {
+	tests := []struct {
+		fixture string
+		parser  ListingParser
+		want    []string
+	}{
+		{"python.html", PythonListing{}, listingWant},
+		//sort links and the parent directory skipped
+		{"apache.html", ApacheListing{}, listingWant},
+		//../ skipped, the off-host link is left for InGitRoot to drop
+		{"nginx.html", NginxListing{}, append(append([]string{}, listingWant...), "http://evil.example/objects/x")},
+		{"nginx.json", NginxJSONListing{}, listingWant},
+		{"nginx.xml", NginxXMLListing{}, listingWant},
+		{"lighttpd.html", LighttpdListing{}, listingWant},
+		//breadcrumbs, layout/sort links, the up link and the caddy link skipped
+		{"caddy.html", CaddyListing{}, listingWant},
+		//absolute hrefs, and the up link skipped
+		{"tomcat.html", TomcatListing{}, listingWant},
+		{"jetty.html", JettyListing{}, listingWant},
+		//pack has no trailing slash in its href, but is marked <dir>
+		{"iis.html", IISListing{}, listingWant},
+	}
+	for _, tt := range tests {
+		t.Run(tt.fixture, func(t *testing.T) {
+			resp := readFixture(t, tt.fixture)
+			if !tt.parser.Detect(resp) {
+				t.Fatalf("%T didn't detect its own listing", tt.parser)
+			}
+			//the registry has to pick the right parser too, not one with a similar looking page
+			if got := DetectListing(resp); reflect.TypeOf(got) != reflect.TypeOf(tt.parser) {
+				t.Errorf("registry detected %T, want %T", got, tt.parser)
+			}
+			if got := tt.parser.Parse(resp, listingBase); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("got %q\nwant %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestListingParsersIgnoreOtherPages(t *testing.T) {
+	pages := map[string][]byte{
+		"html page":   []byte("<html><head><title>Welcome</title></head><body><a href=\"/about\">About</a></body></html>"),
+		"git object":  {0x78, 0x01, 0x2b, 0x49, 0x4d, 0xcc},
+		"config":      []byte("[core]\n\trepositoryformatversion = 0\n"),
+		"json object": []byte(`{"name":"ab","type":"directory"}`),
+		"json empty":  []byte(`[]`),
+		"json null":   []byte(`null`),
+		"json nulls":  []byte(`[null]`),
+		"json number": []byte(`[1]`),
+		"json type":   []byte(`[{"name":"ab","type":"link"}]`),
+		"json name":   []byte(`[{"name":"","type":"file"}]`),
+		"empty":       {},
+	}
+	for name, page := range pages {
+		if p := DetectListing(page); p != nil {
+			t.Errorf("%s detected as %T", name, p)
+		}
+	}
+}
+
+func TestResolveHrefs(t *testing.T) {
+	tests := []struct {
+		href string
+		want string //empty if it should be dropped
+	}{
+		{"ab/", listingBase + "ab/"},
+		{"./ab/", listingBase + "ab/"},
+		{"/.git/objects/ab/", listingBase + "ab/"},
+		{"http://example.com/.git/objects/ab/", listingBase + "ab/"},
+		{"with%20space", listingBase + "with%20space"},
+		{"ab/?C=N;O=D", listingBase + "ab/"},
+		{"ab/#top", listingBase + "ab/"},
+		{"../", ""},
+		{"/", ""},
+		{".", ""},
+		{"http://evil.example/x", "http://evil.example/x"},
+		{"//evil.example/x", "http://evil.example/x"},
+	}
+	for _, tt := range tests {
+		got := resolveHrefs(listingBase, []string{tt.href})
+		if tt.want == "" {
+			if len(got) != 0 {
+				t.Errorf("%q: got %q, want it dropped", tt.href, got)
+			}
+			continue
+		}
+		if len(got) != 1 || got[0] != tt.want {
+			t.Errorf("%q: got %q, want %q", tt.href, got, tt.want)
+		}
+	}
+
+	if got := resolveHrefs(listingBase, []string{"ab/", "./ab/", "/.git/objects/ab/"}); len(got) != 1 {
+		t.Errorf("duplicates not removed: %q", got)
+	}
+}
+
+func TestInGitRoot(t *testing.T) {
+	root := "http://example.com/.git/"
+	tests := []struct {
+		url  string
+		want bool
+	}{
+		{"http://example.com/.git/objects/ab/", true},
+		{"http://example.com/.git/with%20space", true},
+		{"http://example.com/.git/", false},
+		{"http://example.com/.git", false},
+		{"http://example.com/other/", false},
+		{"http://example.com/.gitfoo/HEAD", false},
+		{"https://example.com/.git/HEAD", false},
+		{"http://example.com:8080/.git/HEAD", false},
+		{"http://evil.example/.git/HEAD", false},
+		{"http://example.com/.git/objects/../../etc/passwd", false},
+		{"http://example.com/.git/objects/%2e%2e/%2e%2e/etc/passwd", false},
+		{"http://example.com/.git/./HEAD", false},
+	}
+	for _, tt := range tests {
+		if got := InGitRoot(tt.url, root); got != tt.want {
+			t.Errorf("%s: got %v, want %v", tt.url, got, tt.want)
+		}
+	}
+}
@@ -16,8 +16,7 @@ func LocalWriter(writeChan chan Writeme, localpath string, fileCount *uint64, by
 		os.MkdirAll(localpath, os.ModePerm)
 	}
 
-	for {
-		d := <-writeChan
+	for d := range writeChan {
 		//check we aren't footgunning
 		//thx @justinsteven
 		if d.LocalFilePath != "" && inTrustedRoot(d.LocalFilePath, localpath) != nil {
@@ -30,14 +29,36 @@ func LocalWriter(writeChan chan Writeme, localpath string, fileCount *uint64, by
 		if _, err := os.Stat(dirpath); os.IsNotExist(err) {
 			os.MkdirAll(dirpath, os.ModePerm)
 		}
-		ioutil.WriteFile(d.LocalFilePath, d.Filecontents, 0644)
+		if d.TempFilePath != "" {
+			//streamed straight to disk, so just move it into place
+			if err := os.Rename(d.TempFilePath, d.LocalFilePath); err != nil {
+				fmt.Println("Couldn't move download into place:", err)
+				os.Remove(d.TempFilePath)
+				wgSaveFile.Done()
+				continue
+			}
+			if fi, err := os.Stat(d.LocalFilePath); err == nil {
+				atomic.AddUint64(byteCount, uint64(fi.Size()))
+			}
+		} else {
+			ioutil.WriteFile(d.LocalFilePath, d.Filecontents, 0644)
+			atomic.AddUint64(byteCount, uint64(len(d.Filecontents)))
+		}
 		atomic.AddUint64(fileCount, 1)
-		atomic.AddUint64(byteCount, uint64(len(d.Filecontents)))
 		//signal that file is written (or at least, the above line has finished executing)
 		wgSaveFile.Done()
 	}
 }
 
+// LocalPath joins a slash separated path (relative to the .git dir) onto the output dir, refusing anything that cleans to somewhere outside of it
+func LocalPath(root string, rel string) (string, error) {
+	ret := filepath.Clean(root + string(os.PathSeparator) + filepath.FromSlash(rel))
+	if err := inTrustedRoot(ret, root); err != nil {
+		return "", fmt.Errorf("%s is outside of the output dir", rel)
+	}
+	return ret, nil
+}
+
 func inTrustedRoot(path string, trustedRoot string) error {
 	for path != "/" {
 		path = filepath.Dir(path)
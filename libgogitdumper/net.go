@@ -3,10 +3,40 @@ package libgogitdumper
 import (
 	"errors"
 	"fmt"
+	"io"
 	"io/ioutil"
 	"net/http"
+	"sync"
 )
 
+// ErrNotFound is returned by GetThing for a 404
+var ErrNotFound = errors.New("404 File not found")
+
+// StatusError is returned by GetThing for any other non-200 response
+type StatusError struct {
+	Code int
+}
+
+func (e *StatusError) Error() string {
+	return fmt.Sprintf("Error code: %d\n", e.Code)
+}
+
+// Transient is true for errors worth trying again later: connection problems, rate limiting and gateway errors
+func Transient(err error) bool {
+	if err == nil || errors.Is(err, ErrNotFound) || errors.Is(err, ErrSoftNotFound) || errors.Is(err, ErrNoProxies) ||
+		errors.Is(err, ErrTooLarge) || errors.Is(err, ErrTotalLimit) {
+		return false
+	}
+	var se *StatusError
+	if errors.As(err, &se) {
+		return TransientStatus(se.Code)
+	}
+	return true
+}
+
+// MaxInMemory caps what GetThing will read into memory. Anything that could be bigger should use DownloadToFile.
+var MaxInMemory int64 = 256 << 20
+
 func GetThing(path string, client *http.Client) ([]byte, error) {
 	request, err := http.NewRequest("GET", path, nil)
 	resp, err := client.Do(request)
@@ -15,16 +45,77 @@ func GetThing(path string, client *http.Client) ([]byte, error) {
 	}
 
 	defer resp.Body.Close()
+	if err := checkStatus(resp); err != nil {
+		return nil, err
+	}
+
+	body, err := ioutil.ReadAll(&limitedBody{ReadCloser: resp.Body, left: MaxInMemory})
+	if err != nil {
+		//a partial file is worse than no file
+		return nil, err
+	}
+
+	return body, nil
+}
+
+func checkStatus(resp *http.Response) error {
 	if resp.StatusCode == 404 {
-		return nil, errors.New("404 File not found")
+		return ErrNotFound
 	} else if resp.StatusCode != 200 {
-		return nil, errors.New(fmt.Sprintf("Error code: %d\n", resp.StatusCode))
+		return &StatusError{Code: resp.StatusCode}
 	}
+	return nil
+}
 
-	body, e := ioutil.ReadAll(resp.Body)
-	if e != nil {
-		return body, err
+// Download is a response that was streamed to a temp file
+type Download struct {
+	TempFile string
+	Size     int64
+	Head     []byte //the start of the file, for parsing. All of it if Complete
+}
+
+// Complete is true if the whole file fit in Head
+func (d *Download) Complete() bool {
+	return int64(len(d.Head)) == d.Size
+}
+
+// LimitTransport caps the number of requests in flight at once. A request holds its slot until the body is closed.
+type LimitTransport struct {
+	Next  http.RoundTripper
+	slots chan struct{}
+}
+
+// NewLimitTransport wraps next, allowing at most max requests through at once (0 is unlimited)
+func NewLimitTransport(next http.RoundTripper, max int) *LimitTransport {
+	l := &LimitTransport{Next: next}
+	if max > 0 {
+		l.slots = make(chan struct{}, max)
 	}
+	return l
+}
+
+func (l *LimitTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if l.slots == nil {
+		return l.Next.RoundTrip(req)
+	}
+	l.slots <- struct{}{}
+	resp, err := l.Next.RoundTrip(req)
+	if err != nil {
+		<-l.slots
+		return nil, err
+	}
+	once := &sync.Once{}
+	resp.Body = &releasingBody{ReadCloser: resp.Body, release: func() { once.Do(func() { <-l.slots }) }}
+	return resp, nil
+}
+
+type releasingBody struct {
+	io.ReadCloser
+	release func()
+}
 
-	return body, err
+func (b *releasingBody) Close() error {
+	err := b.ReadCloser.Close()
+	b.release()
+	return err
 }
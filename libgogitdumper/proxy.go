@@ -0,0 +1,236 @@
+package libgogitdumper
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"sync/atomic"
+
+	"golang.org/x/net/http/httpproxy"
+	"golang.org/x/net/proxy"
+)
+
+// ErrNoProxies is returned once every proxy in the list has been ejected
+var ErrNoProxies = errors.New("no healthy proxies left")
+
+// ProxyTransport sends each request through the next healthy proxy in the list. A proxy that fails MaxFailures times in a row
+// (can't be connected to, or rejects the credentials) is ejected for the rest of the run. Targets being down doesn't count against it.
+// Hosts matching NO_PROXY skip the proxies altogether.
+type ProxyTransport struct {
+	MaxFailures int32
+
+	routes []*proxyRoute
+	direct http.RoundTripper
+	bypass func(*url.URL) bool
+	next   uint64
+}
+
+type proxyRoute struct {
+	url       *url.URL
+	transport *http.Transport
+	failures  int32
+	ejected   int32
+}
+
+// NewProxyTransport makes a transport for each proxy in the comma separated list, copied from base.
+// Proxies can be http://, https://, socks5:// (DNS resolved locally) or socks5h:// (DNS resolved by the proxy), with user:pass@ for credentials.
+// A bare host:port is treated as socks5h, which is what -p has always done.
+// Resolve overrides are applied before the target is handed to a socks proxy. http proxies do their own resolving.
+// sni (if not nil) does the TLS handshakes for connections through socks proxies, the same as base does for direct ones.
+func NewProxyTransport(base *http.Transport, list string, overrides ResolveOverrides, sni *SNIDialer) (*ProxyTransport, error) {
+	p := &ProxyTransport{MaxFailures: 3, direct: base, bypass: noProxyFunc()}
+	for _, x := range strings.Split(list, ",") {
+		x = strings.TrimSpace(x)
+		if x == "" {
+			continue
+		}
+		u, err := ParseProxy(x)
+		if err != nil {
+			return nil, err
+		}
+		t := base.Clone()
+		switch u.Scheme {
+		case "http", "https":
+			t.Proxy = http.ProxyURL(u)
+		case "socks5", "socks5h":
+			t.Proxy = nil
+			t.DialContext, err = socksDialer(u, base.DialContext, overrides)
+			if err != nil {
+				return nil, err
+			}
+			if sni != nil {
+				t.DialTLSContext = sni.DialTLSContext(t.DialContext)
+			}
+		}
+		p.routes = append(p.routes, &proxyRoute{url: u, transport: t})
+	}
+	if len(p.routes) == 0 {
+		return nil, errors.New("no proxies given")
+	}
+	return p, nil
+}
+
+// ParseProxy parses a proxy url, defaulting to socks5h when there's no scheme
+func ParseProxy(s string) (*url.URL, error) {
+	if !strings.Contains(s, "://") {
+		s = "socks5h://" + s
+	}
+	u, err := url.Parse(s)
+	if err != nil {
+		return nil, err
+	}
+	switch u.Scheme {
+	case "http", "https", "socks5", "socks5h":
+	default:
+		return nil, fmt.Errorf("unsupported proxy scheme %q in %s (http, https, socks5 or socks5h)", u.Scheme, s)
+	}
+	if u.Host == "" {
+		return nil, fmt.Errorf("no proxy host in %s", s)
+	}
+	return u, nil
+}
+
+// dialFunc lets a DialContext func be used as the socks dialer's forward dialer
+type dialFunc func(ctx context.Context, network, addr string) (net.Conn, error)
+
+func (f dialFunc) Dial(network, addr string) (net.Conn, error) {
+	return f(context.Background(), network, addr)
+}
+
+func (f dialFunc) DialContext(ctx context.Context, network, addr string) (net.Conn, error) {
+	return f(ctx, network, addr)
+}
+
+func socksDialer(u *url.URL, forward dialFunc, overrides ResolveOverrides) (func(ctx context.Context, network, addr string) (net.Conn, error), error) {
+	var auth *proxy.Auth
+	if u.User != nil {
+		pass, _ := u.User.Password()
+		auth = &proxy.Auth{User: u.User.Username(), Password: pass}
+	}
+	if forward == nil {
+		forward = (&net.Dialer{}).DialContext
+	}
+	d, err := proxy.SOCKS5("tcp", u.Host, auth, forward)
+	if err != nil {
+		return nil, err
+	}
+	cd := d.(proxy.ContextDialer)
+	return func(ctx context.Context, network, addr string) (net.Conn, error) {
+		addr = overrides.Addr(addr)
+		if u.Scheme == "socks5h" {
+			return cd.DialContext(ctx, network, addr)
+		}
+		//plain socks5 resolves the name here, and only gives the proxy an ip
+		host, port, err := net.SplitHostPort(addr)
+		if err != nil {
+			return nil, err
+		}
+		if net.ParseIP(host) == nil {
+			ips, err := net.DefaultResolver.LookupIPAddr(ctx, host)
+			if err != nil {
+				return nil, err
+			}
+			if len(ips) == 0 {
+				return nil, fmt.Errorf("no addresses found for %s", host)
+			}
+			addr = net.JoinHostPort(ips[0].IP.String(), port)
+		}
+		return cd.DialContext(ctx, network, addr)
+	}, nil
+}
+
+// noProxyFunc matches hosts against NO_PROXY, the same way net/http does for the environment proxies
+func noProxyFunc() func(*url.URL) bool {
+	noProxy := os.Getenv("NO_PROXY")
+	if noProxy == "" {
+		noProxy = os.Getenv("no_proxy")
+	}
+	if noProxy == "" {
+		return func(*url.URL) bool { return false }
+	}
+	//httpproxy only tells us whether it would use a proxy, so give it a placeholder one to decide about
+	f := (&httpproxy.Config{HTTPProxy: "placeholder:1", HTTPSProxy: "placeholder:1", NoProxy: noProxy}).ProxyFunc()
+	return func(u *url.URL) bool {
+		p, err := f(u)
+		return err == nil && p == nil
+	}
+}
+
+func (p *ProxyTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if p.bypass(req.URL) {
+		return p.direct.RoundTrip(req)
+	}
+	route := p.pick()
+	if route == nil {
+		return nil, ErrNoProxies
+	}
+	resp, err := route.transport.RoundTrip(req)
+	if (err != nil && proxyFault(err)) || (err == nil && resp.StatusCode == 407) {
+		p.fail(route, err, resp)
+	} else {
+		atomic.StoreInt32(&route.failures, 0)
+	}
+	return resp, err
+}
+
+// proxyFault is true when the error came from the proxy rather than the target. The only thing dialled directly is the proxy,
+// so any dial error in the chain means we couldn't reach it.
+func proxyFault(err error) bool {
+	for e := err; e != nil; e = errors.Unwrap(e) {
+		if op, ok := e.(*net.OpError); ok && op.Op == "dial" {
+			return true
+		}
+	}
+	s := err.Error()
+	return strings.Contains(s, "Proxy Authentication Required") || strings.Contains(s, "authentication failed")
+}
+
+// pick round robins over the proxies that haven't been ejected
+func (p *ProxyTransport) pick() *proxyRoute {
+	for i := 0; i < len(p.routes); i++ {
+		r := p.routes[(atomic.AddUint64(&p.next, 1)-1)%uint64(len(p.routes))]
+		if atomic.LoadInt32(&r.ejected) == 0 {
+			return r
+		}
+	}
+	return nil
+}
+
+func (p *ProxyTransport) fail(r *proxyRoute, err error, resp *http.Response) {
+	if atomic.AddInt32(&r.failures, 1) < p.MaxFailures || !atomic.CompareAndSwapInt32(&r.ejected, 0, 1) {
+		return
+	}
+	reason := fmt.Sprint(err)
+	if err == nil {
+		reason = resp.Status
+	}
+	fmt.Printf("Proxy %s failed %d times in a row, no longer using it (last error: %s). %d proxies left\n", r.url.Redacted(), p.MaxFailures, reason, len(p.Healthy()))
+	r.transport.CloseIdleConnections()
+}
+
+// Healthy lists the proxies still in use
+func (p *ProxyTransport) Healthy() []string {
+	ret := []string{}
+	for _, x := range p.routes {
+		if atomic.LoadInt32(&x.ejected) == 0 {
+			ret = append(ret, x.url.Redacted())
+		}
+	}
+	return ret
+}
+
+// Ejected lists the proxies that have been dropped
+func (p *ProxyTransport) Ejected() []string {
+	ret := []string{}
+	for _, x := range p.routes {
+		if atomic.LoadInt32(&x.ejected) == 1 {
+			ret = append(ret, x.url.Redacted())
+		}
+	}
+	return ret
+}
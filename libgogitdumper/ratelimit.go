@@ -0,0 +1,172 @@
+package libgogitdumper
+
+import (
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// RateTransport limits the request rate to each host with a token bucket. Every window of requests it looks at the error rate and latency,
+// halving the rate if the host looks like it's struggling and creeping back up to the configured rate once it's healthy again.
+// A global bucket caps the total across every host as well, so dumping hundreds of targets at once stays under one overall rate.
+type RateTransport struct {
+	Next       http.RoundTripper
+	Rate       float64 //requests per second per host, 0 for no limit
+	GlobalRate float64 //requests per second across all hosts, 0 for no limit
+	Burst      int
+
+	MinRate        float64       //never slow down past this
+	ErrorThreshold float64       //fraction of errors (connection errors, 429 and 5xx) in a window that counts as struggling
+	SlowLatency    time.Duration //average latency in a window that counts as struggling
+	Window         int           //requests per window
+
+	mutex   *sync.Mutex
+	buckets map[string]*tokenBucket
+	global  *tokenBucket
+}
+
+// NewRateTransport wraps next, allowing rate requests per second to each host and globalRate requests per second overall,
+// with bursts of up to burst
+func NewRateTransport(next http.RoundTripper, rate float64, globalRate float64, burst int) *RateTransport {
+	r := &RateTransport{
+		Next:           next,
+		Rate:           rate,
+		GlobalRate:     globalRate,
+		Burst:          burst,
+		MinRate:        0.5,
+		ErrorThreshold: 0.1,
+		SlowLatency:    3 * time.Second,
+		Window:         20,
+		mutex:          &sync.Mutex{},
+		buckets:        make(map[string]*tokenBucket),
+	}
+	if globalRate > 0 {
+		r.global = newTokenBucket(globalRate, burst)
+	}
+	return r
+}
+
+func (r *RateTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if r.Rate <= 0 && r.global == nil {
+		return r.Next.RoundTrip(req)
+	}
+	var b *tokenBucket
+	if r.Rate > 0 {
+		b = r.bucket(req.URL.Host)
+		if err := b.wait(req); err != nil {
+			return nil, err
+		}
+	}
+	//the host's turn first, so a slow host doesn't sit on a global token while it waits
+	if r.global != nil {
+		if err := r.global.wait(req); err != nil {
+			return nil, err
+		}
+	}
+	start := time.Now()
+	resp, err := r.Next.RoundTrip(req)
+	if b != nil {
+		failed := err != nil || resp.StatusCode == 429 || resp.StatusCode >= 500
+		b.record(r, req.URL.Host, failed, time.Since(start))
+	}
+	return resp, err
+}
+
+func (r *RateTransport) bucket(host string) *tokenBucket {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	b, ok := r.buckets[host]
+	if !ok {
+		b = newTokenBucket(r.Rate, r.Burst)
+		r.buckets[host] = b
+	}
+	return b
+}
+
+// newTokenBucket starts a bucket full. A burst under 1 defaults to the rate (and at least 1).
+func newTokenBucket(rate float64, burst int) *tokenBucket {
+	if burst < 1 {
+		burst = int(rate)
+		if burst < 1 {
+			burst = 1
+		}
+	}
+	return &tokenBucket{rate: rate, tokens: float64(burst), burst: float64(burst), last: time.Now()}
+}
+
+type tokenBucket struct {
+	mutex  sync.Mutex
+	rate   float64
+	burst  float64
+	tokens float64
+	last   time.Time
+
+	//stats for the current window
+	requests int
+	errors   int
+	latency  time.Duration
+}
+
+// wait blocks until there's a token to spend, or the request is cancelled
+func (b *tokenBucket) wait(req *http.Request) error {
+	for {
+		b.mutex.Lock()
+		now := time.Now()
+		b.tokens += now.Sub(b.last).Seconds() * b.rate
+		if b.tokens > b.burst {
+			b.tokens = b.burst
+		}
+		b.last = now
+		if b.tokens >= 1 {
+			b.tokens--
+			b.mutex.Unlock()
+			return nil
+		}
+		delay := time.Duration((1 - b.tokens) / b.rate * float64(time.Second))
+		b.mutex.Unlock()
+
+		timer := time.NewTimer(delay)
+		select {
+		case <-req.Context().Done():
+			timer.Stop()
+			return req.Context().Err()
+		case <-timer.C:
+		}
+	}
+}
+
+// record adds a response to the window, and adjusts the rate once the window is full
+func (b *tokenBucket) record(r *RateTransport, host string, failed bool, latency time.Duration) {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	b.requests++
+	b.latency += latency
+	if failed {
+		b.errors++
+	}
+	if b.requests < r.Window {
+		return
+	}
+
+	errRate := float64(b.errors) / float64(b.requests)
+	avg := b.latency / time.Duration(b.requests)
+	b.requests, b.errors, b.latency = 0, 0, 0
+
+	old := b.rate
+	if errRate > r.ErrorThreshold || avg > r.SlowLatency {
+		b.rate /= 2
+		if b.rate < r.MinRate {
+			b.rate = r.MinRate
+		}
+	} else if b.rate < r.Rate {
+		//back up gently, a tenth of the configured rate per healthy window
+		b.rate += r.Rate / 10
+		if b.rate > r.Rate {
+			b.rate = r.Rate
+		}
+	}
+	if b.rate != old {
+		fmt.Printf("Rate limit for %s changed from %.2f to %.2f req/s (%.0f%% errors, %v average latency)\n", host, old, b.rate, errRate*100, avg.Round(time.Millisecond))
+	}
+}
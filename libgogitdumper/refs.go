@@ -0,0 +1,186 @@
+package libgogitdumper
+
+import (
+	"bufio"
+	"bytes"
+	"os"
+	"regexp"
+	"strings"
+)
+
+// DefaultRefNames is the built in list of branch/tag names to guess when we can't list refs/
+var DefaultRefNames = []string{
+	"master", "main", "develop", "development", "dev", "staging", "stage",
+	"production", "prod", "live", "release", "releases", "test", "testing",
+	"qa", "uat", "hotfix", "feature", "trunk", "stable", "next", "gh-pages",
+	"backup", "old", "wip", "temp", "tmp",
+	"release/1.0", "release/2.0", "release/v1", "release/v2",
+	"v0.1", "v0.1.0", "v1", "v1.0", "v1.0.0", "v1.1", "v1.1.0", "v1.2", "v1.2.0",
+	"v1.2.3", "v2", "v2.0", "v2.0.0", "v3", "v3.0", "v3.0.0",
+	"1.0", "1.0.0", "2.0", "2.0.0",
+}
+
+// DefaultRemotes is used when the config file doesn't tell us about any remotes
+var DefaultRemotes = []string{"origin"}
+
+// HiddenRefs are refs (and bisect state files) outside of heads/tags/remotes that can't be guessed from a wordlist.
+// These tend to point at commits that have been scrubbed out of the main history.
+var HiddenRefs = []string{
+	"refs/notes/commits", "logs/refs/notes/commits",
+	"refs/notes/review", "logs/refs/notes/review",
+	"refs/bisect/bad", "refs/bisect/new", "refs/bisect/old",
+	"BISECT_LOG", "BISECT_START", "BISECT_TERMS", "BISECT_EXPECTED_REV", "BISECT_ANCESTORS_OK", "BISECT_NAMES",
+}
+
+var remoteRe = regexp.MustCompile(`\[remote "([^"]+)"\]`)
+
+// ReadWordlist reads a list of ref names from a file, one per line. Blank lines and lines starting with # are skipped.
+func ReadWordlist(path string) ([]string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	ret := []string{}
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		ret = append(ret, line)
+	}
+	return ret, scanner.Err()
+}
+
+// ParseRemotes pulls the remote names out of a git config file
+func ParseRemotes(config []byte) []string {
+	ret := []string{}
+	for _, x := range remoteRe.FindAllSubmatch(config, -1) {
+		ret = append(ret, string(bytes.TrimSpace(x[1])))
+	}
+	return ret
+}
+
+// GuessRefPaths builds the list of ref (and matching reflog) paths, relative to the .git dir, for every name in the wordlist
+func GuessRefPaths(names []string, remotes []string) []string {
+	ret := []string{}
+	for _, remote := range remotes {
+		ret = append(ret,
+			"refs/remotes/"+remote+"/HEAD",
+			"logs/refs/remotes/"+remote+"/HEAD",
+		)
+	}
+	for _, name := range names {
+		name = strings.Trim(name, "/")
+		if name == "" {
+			continue
+		}
+		ret = append(ret,
+			"refs/heads/"+name, "logs/refs/heads/"+name,
+			"refs/tags/"+name, "logs/refs/tags/"+name,
+		)
+		for _, remote := range remotes {
+			ret = append(ret,
+				"refs/remotes/"+remote+"/"+name,
+				"logs/refs/remotes/"+remote+"/"+name,
+			)
+		}
+	}
+	return ret
+}
+
+// GuessHiddenRefPaths builds the refs/original/ (left behind by filter-branch) and refs/prefetch/ paths for every name in the wordlist.
+// refs/replace/ and refs/bisect/good-* are named after object hashes so can't be guessed, they get picked up from packed-refs/info/refs/BISECT_LOG instead.
+func GuessHiddenRefPaths(names []string, remotes []string) []string {
+	ret := []string{}
+	for _, name := range names {
+		name = strings.Trim(name, "/")
+		if name == "" {
+			continue
+		}
+		ret = append(ret,
+			"refs/original/refs/heads/"+name, "logs/refs/original/refs/heads/"+name,
+			"refs/original/refs/tags/"+name,
+		)
+		for _, remote := range remotes {
+			ret = append(ret,
+				"refs/original/refs/remotes/"+remote+"/"+name,
+				"refs/prefetch/remotes/"+remote+"/"+name, "logs/refs/prefetch/remotes/"+remote+"/"+name,
+			)
+		}
+	}
+	return ret
+}
+
+// Ref is a single advertised ref, as found in info/refs or packed-refs
+type Ref struct {
+	Sha1   string
+	Name   string
+	Peeled bool //the ^{} line that points at the commit an annotated tag refers to
+}
+
+var sha1Re = regexp.MustCompile("^[0-9a-fA-F]{40}$")
+
+// ValidRefName checks that a ref name from the server is something under refs/, and can't be used to point at a path anywhere else
+func ValidRefName(name string) bool {
+	if !strings.HasPrefix(name, "refs/") || strings.ContainsAny(name, "\\\x00") {
+		return false
+	}
+	for _, seg := range strings.Split(name, "/") {
+		if seg == "" || seg == "." || seg == ".." {
+			return false
+		}
+	}
+	return true
+}
+
+// ParseInfoRefs parses the dumb http protocol info/refs file (<sha>\t<refname>, one per line). Anything that isn't a valid ref name is skipped.
+func ParseInfoRefs(b []byte) []Ref {
+	ret := []Ref{}
+	for _, line := range strings.Split(string(b), "\n") {
+		parts := strings.SplitN(strings.TrimSpace(line), "\t", 2)
+		if len(parts) != 2 || !sha1Re.MatchString(parts[0]) {
+			continue
+		}
+		r := Ref{Sha1: strings.ToLower(parts[0]), Name: parts[1]}
+		if strings.HasSuffix(r.Name, "^{}") {
+			r.Name = strings.TrimSuffix(r.Name, "^{}")
+			r.Peeled = true
+		}
+		if !ValidRefName(r.Name) {
+			continue
+		}
+		ret = append(ret, r)
+	}
+	return ret
+}
+
+// ReflogEntry is a single line out of a logs/ file
+type ReflogEntry struct {
+	Old       string
+	New       string
+	Committer string //name <email> timestamp tz
+	Message   string
+}
+
+// ParseReflog parses a reflog (<old> <new> <committer>\t<message>, one per line)
+func ParseReflog(b []byte) []ReflogEntry {
+	ret := []ReflogEntry{}
+	for _, line := range strings.Split(string(b), "\n") {
+		if len(line) < 82 || !sha1Re.MatchString(line[:40]) || !sha1Re.MatchString(line[41:81]) {
+			continue
+		}
+		e := ReflogEntry{Old: line[:40], New: line[41:81]}
+		rest := strings.TrimSpace(line[81:])
+		if i := strings.IndexByte(rest, '\t'); i >= 0 {
+			e.Committer = rest[:i]
+			e.Message = rest[i+1:]
+		} else {
+			e.Committer = rest
+		}
+		ret = append(ret, e)
+	}
+	return ret
+}
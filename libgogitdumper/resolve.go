@@ -0,0 +1,46 @@
+package libgogitdumper
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"strings"
+)
+
+// ResolveOverrides maps host:port to the address to connect to instead, like curl's --resolve
+type ResolveOverrides map[string]string
+
+// ParseResolve reads host:port:addr entries. addr can be an ipv6 address, with or without brackets.
+func ParseResolve(entries []string) (ResolveOverrides, error) {
+	ret := ResolveOverrides{}
+	for _, x := range entries {
+		parts := strings.SplitN(x, ":", 3)
+		if len(parts) != 3 || parts[0] == "" || parts[1] == "" || parts[2] == "" {
+			return nil, fmt.Errorf("bad resolve entry %q, should be host:port:addr", x)
+		}
+		addr := strings.TrimSuffix(strings.TrimPrefix(parts[2], "["), "]")
+		if net.ParseIP(addr) == nil {
+			return nil, fmt.Errorf("bad resolve entry %q, %s is not an ip address", x, addr)
+		}
+		ret[net.JoinHostPort(strings.ToLower(parts[0]), parts[1])] = net.JoinHostPort(addr, parts[1])
+	}
+	return ret, nil
+}
+
+// Addr gives the overridden address for host:port, or addr unchanged if there isn't one
+func (r ResolveOverrides) Addr(addr string) string {
+	if x, ok := r[strings.ToLower(addr)]; ok {
+		return x
+	}
+	return addr
+}
+
+// DialContext wraps dial so overridden names connect to their address. The name is still used for the Host header and SNI.
+func (r ResolveOverrides) DialContext(dial func(ctx context.Context, network, addr string) (net.Conn, error)) func(ctx context.Context, network, addr string) (net.Conn, error) {
+	if len(r) == 0 {
+		return dial
+	}
+	return func(ctx context.Context, network, addr string) (net.Conn, error) {
+		return dial(ctx, network, r.Addr(addr))
+	}
+}
@@ -0,0 +1,86 @@
+package libgogitdumper
+
+import (
+	"context"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestParseResolve(t *testing.T) {
+	tests := []struct {
+		entries []string
+		want    ResolveOverrides //nil for an error
+	}{
+		{nil, ResolveOverrides{}},
+		{[]string{"Example.com:443:10.0.0.1"}, ResolveOverrides{"example.com:443": "10.0.0.1:443"}},
+		{[]string{"example.com:80:::1"}, ResolveOverrides{"example.com:80": "[::1]:80"}},
+		{[]string{"example.com:80:[2001:db8::1]", "other:8080:127.0.0.1"}, ResolveOverrides{"example.com:80": "[2001:db8::1]:80", "other:8080": "127.0.0.1:8080"}},
+		{[]string{"example.com:443"}, nil},
+		{[]string{"example.com::10.0.0.1"}, nil},
+		{[]string{":443:10.0.0.1"}, nil},
+		{[]string{"example.com:443:"}, nil},
+		{[]string{"example.com:443:not-an-ip"}, nil},
+	}
+	for _, tt := range tests {
+		got, err := ParseResolve(tt.entries)
+		if tt.want == nil {
+			if err == nil {
+				t.Errorf("%q: got %v, want an error", tt.entries, got)
+			}
+			continue
+		}
+		if err != nil || len(got) != len(tt.want) {
+			t.Errorf("%q: got %v %v, want %v", tt.entries, got, err, tt.want)
+			continue
+		}
+		for k, v := range tt.want {
+			if got[k] != v {
+				t.Errorf("%q: %s -> %q, want %q", tt.entries, k, got[k], v)
+			}
+		}
+	}
+
+	r, _ := ParseResolve([]string{"example.com:443:10.0.0.1"})
+	for addr, want := range map[string]string{"example.com:443": "10.0.0.1:443", "EXAMPLE.com:443": "10.0.0.1:443", "example.com:80": "example.com:80"} {
+		if got := r.Addr(addr); got != want {
+			t.Errorf("Addr(%s): got %s, want %s", addr, got, want)
+		}
+	}
+}
+
+func TestResolveDialContext(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, r.Host)
+	}))
+	defer ts.Close()
+	_, port, _ := net.SplitHostPort(ts.Listener.Addr().String())
+
+	r, err := ParseResolve([]string{"git.example.invalid:" + port + ":127.0.0.1"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	dialer := &net.Dialer{}
+	client := &http.Client{Transport: &http.Transport{DialContext: r.DialContext(dialer.DialContext)}}
+	resp, err := client.Get("http://git.example.invalid:" + port + "/.git/HEAD")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	//connects to the override, but still asks for the name
+	if b, _ := io.ReadAll(resp.Body); !strings.HasPrefix(string(b), "git.example.invalid") {
+		t.Errorf("server saw Host %q", b)
+	}
+
+	//nothing to override hands back the dialer untouched
+	if got := ResolveOverrides(nil).DialContext(dialer.DialContext); got == nil {
+		t.Error("nil dialer with no overrides")
+	} else if conn, err := got(context.Background(), "tcp", ts.Listener.Addr().String()); err != nil {
+		t.Error(err)
+	} else {
+		conn.Close()
+	}
+}
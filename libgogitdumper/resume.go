@@ -0,0 +1,180 @@
+package libgogitdumper
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// resumeSidecarMin is how big a download has to be before its validator gets saved next to the .part file, so a later run can pick it up
+const resumeSidecarMin = 1 << 20
+
+// errRestart means the partial file can't be trusted, and the download needs to start from the beginning
+var errRestart = errors.New("partial download doesn't match, starting over")
+
+// DownloadToFile streams a response to partFile (to be renamed into place), then reads the first keep bytes back for parsing.
+// If the connection drops part way it resumes with a Range request, up to retries times. If-Range (with the ETag or Last-Modified
+// from the first response) makes the server send the whole file again if it has changed, and servers that ignore ranges just get
+// downloaded from scratch. A .part left from an earlier run is resumed too, if its sidecar file says which version it was.
+// Going over limit (0 for none) removes the partial file and returns ErrTooLarge.
+func DownloadToFile(path string, client *http.Client, partFile string, keep int, limit int64, retries int) (*Download, error) {
+	if err := os.MkdirAll(filepath.Dir(partFile), os.ModePerm); err != nil {
+		return nil, err
+	}
+	validator := ""
+	var offset int64
+	if b, err := os.ReadFile(partFile + ".meta"); err == nil {
+		validator = strings.TrimSpace(string(b))
+		if fi, err := os.Stat(partFile); err == nil && validator != "" {
+			offset = fi.Size()
+			fmt.Printf("Resuming %s from %d bytes\n", path, offset)
+		}
+	}
+
+	for attempt := 0; ; {
+		err := downloadPart(path, client, partFile, &offset, &validator, limit)
+		if err == nil {
+			os.Remove(partFile + ".meta")
+			head, err := readHead(partFile, keep)
+			if err != nil {
+				os.Remove(partFile)
+				return nil, err
+			}
+			return &Download{TempFile: partFile, Size: offset, Head: head}, nil
+		}
+		if err == errRestart {
+			fmt.Println(err, path)
+			offset, validator = 0, ""
+			continue
+		}
+
+		var se *StatusError
+		resumable := offset > 0 && !errors.Is(err, ErrTooLarge) && !errors.Is(err, ErrNotFound) && !errors.As(err, &se)
+		if !resumable || attempt >= retries {
+			if !resumable || validator == "" {
+				os.Remove(partFile)
+				os.Remove(partFile + ".meta")
+			}
+			return nil, err
+		}
+		fmt.Printf("Download of %s dropped at %d bytes (%v), resuming\n", path, offset, err)
+		time.Sleep(500 * time.Millisecond << attempt)
+		attempt++
+	}
+}
+
+// downloadPart requests everything from offset on, appending to partFile. offset is kept up to date with what's on disk even when it fails.
+func downloadPart(path string, client *http.Client, partFile string, offset *int64, validator *string, limit int64) error {
+	request, err := http.NewRequest("GET", path, nil)
+	if err != nil {
+		return err
+	}
+	if *offset > 0 {
+		request.Header.Set("Range", fmt.Sprintf("bytes=%d-", *offset))
+		if *validator != "" {
+			request.Header.Set("If-Range", *validator)
+		}
+	}
+	resp, err := client.Do(request)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	flags := os.O_CREATE | os.O_WRONLY
+	switch {
+	case *offset > 0 && resp.StatusCode == 206:
+		if start, ok := contentRangeStart(resp.Header.Get("Content-Range")); !ok || start != *offset {
+			return errRestart
+		}
+		flags |= os.O_APPEND
+	case *offset > 0 && resp.StatusCode == 416:
+		//nothing left to send, as long as the file is the size we've got. Without a size to check, the .part could be cut short
+		if total, ok := contentRangeTotal(resp.Header.Get("Content-Range")); !ok || total != *offset {
+			return errRestart
+		}
+		return nil
+	case resp.StatusCode == 200:
+		if *offset > 0 {
+			fmt.Println("Server sent the whole file instead of resuming, starting over:", path)
+		}
+		*offset = 0
+		flags |= os.O_TRUNC
+		*validator = validatorFor(resp)
+		if *validator != "" && (resp.ContentLength < 0 || resp.ContentLength > resumeSidecarMin) {
+			os.WriteFile(partFile+".meta", []byte(*validator+"\n"), 0644)
+		}
+	default:
+		if err := checkStatus(resp); err != nil {
+			return err
+		}
+		return &StatusError{Code: resp.StatusCode}
+	}
+
+	f, err := os.OpenFile(partFile, flags, 0644)
+	if err != nil {
+		return err
+	}
+	var body io.Reader = resp.Body
+	if limit > 0 {
+		body = &limitedBody{ReadCloser: resp.Body, left: limit - *offset}
+	}
+	n, err := io.Copy(f, body)
+	*offset += n
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	return err
+}
+
+// validatorFor picks what to send in If-Range. Weak etags aren't allowed there, so those fall back to Last-Modified.
+func validatorFor(resp *http.Response) string {
+	if etag := resp.Header.Get("ETag"); etag != "" && !strings.HasPrefix(etag, "W/") {
+		return etag
+	}
+	return resp.Header.Get("Last-Modified")
+}
+
+// contentRangeStart gets the first byte from "bytes 100-199/200"
+func contentRangeStart(s string) (int64, bool) {
+	s = strings.TrimPrefix(s, "bytes ")
+	dash := strings.Index(s, "-")
+	if dash < 0 {
+		return 0, false
+	}
+	start, err := strconv.ParseInt(s[:dash], 10, 64)
+	return start, err == nil
+}
+
+// contentRangeTotal gets the full size from "bytes */200" (or "bytes 100-199/200")
+func contentRangeTotal(s string) (int64, bool) {
+	slash := strings.LastIndex(s, "/")
+	if slash < 0 {
+		return 0, false
+	}
+	total, err := strconv.ParseInt(s[slash+1:], 10, 64)
+	return total, err == nil
+}
+
+func readHead(path string, keep int) ([]byte, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	if fi, err := f.Stat(); err == nil && fi.Size() < int64(keep) {
+		keep = int(fi.Size())
+	}
+	head := make([]byte, keep)
+	n, err := io.ReadFull(f, head)
+	if err != nil && err != io.ErrUnexpectedEOF && err != io.EOF {
+		return nil, err
+	}
+	return head[:n], nil
+}
@@ -0,0 +1,248 @@
+package libgogitdumper
+
+import (
+	"bytes"
+	"errors"
+	"math/rand"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// droppingWriter cuts the connection once n bytes of the body have gone out
+type droppingWriter struct {
+	http.ResponseWriter
+	n int
+}
+
+func (d *droppingWriter) Write(p []byte) (int, error) {
+	if len(p) > d.n {
+		d.ResponseWriter.Write(p[:d.n])
+		d.ResponseWriter.(http.Flusher).Flush()
+		panic(http.ErrAbortHandler)
+	}
+	d.n -= len(p)
+	return d.ResponseWriter.Write(p)
+}
+
+// chunkedWriter drops the Content-Length, so the size isn't known until the body ends
+type chunkedWriter struct {
+	http.ResponseWriter
+}
+
+func (c chunkedWriter) WriteHeader(code int) {
+	c.Header().Del("Content-Length")
+	c.ResponseWriter.WriteHeader(code)
+}
+
+func (c chunkedWriter) Flush() {
+	c.ResponseWriter.(http.Flusher).Flush()
+}
+
+// flakyFile serves content with ranges and If-Range (by ETag) unless noRanges is set, dropping the first drops responses after dropAfter bytes.
+// Every request's headers are kept.
+type flakyFile struct {
+	mutex     sync.Mutex
+	content   []byte
+	etag      string
+	drops     int
+	dropAfter int
+	noRanges  bool
+	chunked   bool
+	requests  []http.Header
+	handler   func(w http.ResponseWriter, r *http.Request) bool //runs first, true if it dealt with the request
+}
+
+func (f *flakyFile) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	f.mutex.Lock()
+	f.requests = append(f.requests, r.Header.Clone())
+	if f.handler != nil && f.handler(w, r) {
+		f.mutex.Unlock()
+		return
+	}
+	content, etag := f.content, f.etag
+	if f.chunked {
+		w = chunkedWriter{w}
+	}
+	if f.drops > 0 {
+		f.drops--
+		w = &droppingWriter{ResponseWriter: w, n: f.dropAfter}
+	}
+	f.mutex.Unlock()
+	if f.noRanges {
+		w.Header().Set("Content-Length", strconv.Itoa(len(content)))
+		w.Write(content)
+		return
+	}
+	w.Header().Set("ETag", etag)
+	http.ServeContent(w, r, "", time.Time{}, bytes.NewReader(content))
+}
+
+func randomBytes(n int) []byte {
+	b := make([]byte, n)
+	rand.New(rand.NewSource(int64(n))).Read(b)
+	return b
+}
+
+func checkDownload(t *testing.T, dl *Download, want []byte) {
+	t.Helper()
+	got, err := os.ReadFile(dl.TempFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got, want) || dl.Size != int64(len(want)) {
+		t.Errorf("got %d bytes (size %d), want %d identical bytes", len(got), dl.Size, len(want))
+	}
+	if _, err := os.Stat(dl.TempFile + ".meta"); err == nil {
+		t.Error("sidecar left behind after a finished download")
+	}
+}
+
+func TestDownloadToFileResume(t *testing.T) {
+	content := randomBytes(100 << 10)
+	f := &flakyFile{content: content, etag: `"v1"`, drops: 2, dropAfter: 30 << 10}
+	ts := httptest.NewServer(f)
+	defer ts.Close()
+
+	dl, err := DownloadToFile(ts.URL+"/pack", ts.Client(), filepath.Join(t.TempDir(), "pack.part"), 1024, 0, 3)
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkDownload(t, dl, content)
+	if !bytes.Equal(dl.Head, content[:1024]) {
+		t.Error("head doesn't match the start of the file")
+	}
+
+	//first from scratch, then each resume carries on from what's on disk, checking it's still the same file
+	if len(f.requests) != 3 {
+		t.Fatalf("made %d requests, want 3", len(f.requests))
+	}
+	wantRanges := []string{"", "bytes=30720-", "bytes=61440-"}
+	for i, h := range f.requests {
+		if h.Get("Range") != wantRanges[i] {
+			t.Errorf("request %d: Range %q, want %q", i, h.Get("Range"), wantRanges[i])
+		}
+		if i > 0 && h.Get("If-Range") != `"v1"` {
+			t.Errorf("request %d: If-Range %q", i, h.Get("If-Range"))
+		}
+	}
+}
+
+func TestDownloadToFileChanged(t *testing.T) {
+	content := randomBytes(100 << 10)
+	changed := randomBytes(80 << 10)
+	f := &flakyFile{content: content, etag: `"v1"`, drops: 1, dropAfter: 30 << 10}
+	f.handler = func(w http.ResponseWriter, r *http.Request) bool {
+		//the file changes as soon as the first response is cut off, so the If-Range no longer matches
+		if len(f.requests) == 2 {
+			f.content, f.etag = changed, `"v2"`
+		}
+		return false
+	}
+	ts := httptest.NewServer(f)
+	defer ts.Close()
+
+	dl, err := DownloadToFile(ts.URL+"/pack", ts.Client(), filepath.Join(t.TempDir(), "pack.part"), 1024, 0, 3)
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkDownload(t, dl, changed)
+}
+
+func TestDownloadToFileIgnoresRanges(t *testing.T) {
+	content := randomBytes(100 << 10)
+	//no etag and no ranges, a resume just gets the whole thing again
+	f := &flakyFile{content: content, drops: 1, dropAfter: 30 << 10, noRanges: true}
+	ts := httptest.NewServer(f)
+	defer ts.Close()
+
+	dl, err := DownloadToFile(ts.URL+"/pack", ts.Client(), filepath.Join(t.TempDir(), "pack.part"), 1024, 0, 3)
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkDownload(t, dl, content)
+}
+
+func TestDownloadToFile416(t *testing.T) {
+	content := randomBytes(100 << 10)
+	tests := []struct {
+		name         string
+		contentRange string
+	}{
+		{"no content-range", ""},
+		{"bad content-range", "bytes */x"},
+		{"wrong size", "bytes */30720"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f := &flakyFile{content: content, etag: `"v1"`, drops: 1, dropAfter: 40 << 10}
+			f.handler = func(w http.ResponseWriter, r *http.Request) bool {
+				if r.Header.Get("Range") == "" {
+					return false
+				}
+				//claims there's nothing left, but the .part is short of the real size (or there's no size to check it against)
+				if tt.contentRange != "" {
+					w.Header().Set("Content-Range", tt.contentRange)
+				}
+				w.WriteHeader(416)
+				return true
+			}
+			ts := httptest.NewServer(f)
+			defer ts.Close()
+
+			dl, err := DownloadToFile(ts.URL+"/pack", ts.Client(), filepath.Join(t.TempDir(), "pack.part"), 1024, 0, 3)
+			if err != nil {
+				t.Fatal(err)
+			}
+			checkDownload(t, dl, content)
+		})
+	}
+}
+
+func TestDownloadToFileLimitAcrossResumes(t *testing.T) {
+	content := randomBytes(100 << 10)
+	f := &flakyFile{content: content, etag: `"v1"`, drops: 10, dropAfter: 30 << 10, chunked: true}
+	ts := httptest.NewServer(f)
+	defer ts.Close()
+
+	//no sizes up front, and every part fits under the limit on its own, but the file as a whole doesn't
+	client := &http.Client{Transport: NewSizeLimitTransport(ts.Client().Transport, 50<<10)}
+	part := filepath.Join(t.TempDir(), "pack.part")
+	_, err := DownloadToFile(ts.URL+"/pack", client, part, 1024, 0, 5)
+	if !errors.Is(err, ErrTooLarge) {
+		t.Fatalf("got %v, want ErrTooLarge", err)
+	}
+	if _, err := os.Stat(part); err == nil {
+		t.Error("partial file left behind")
+	}
+}
+
+func TestDownloadToFileSidecar(t *testing.T) {
+	content := randomBytes(resumeSidecarMin + 100<<10)
+	f := &flakyFile{content: content, etag: `"v1"`, drops: 1, dropAfter: 300 << 10}
+	ts := httptest.NewServer(f)
+	defer ts.Close()
+
+	//the first run gives up straight away, leaving the .part and its validator for the next one
+	part := filepath.Join(t.TempDir(), "pack.part")
+	if _, err := DownloadToFile(ts.URL+"/pack", ts.Client(), part, 1024, 0, 0); err == nil {
+		t.Fatal("expected the dropped connection to be an error")
+	}
+	if b, err := os.ReadFile(part + ".meta"); err != nil || strings.TrimSpace(string(b)) != `"v1"` {
+		t.Fatalf("sidecar %q %v", b, err)
+	}
+	dl, err := DownloadToFile(ts.URL+"/pack", ts.Client(), part, 1024, 0, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkDownload(t, dl, content)
+	if last := f.requests[len(f.requests)-1]; last.Get("Range") != "bytes=307200-" || last.Get("If-Range") != `"v1"` {
+		t.Errorf("second run didn't resume: Range %q If-Range %q", last.Get("Range"), last.Get("If-Range"))
+	}
+}
@@ -0,0 +1,121 @@
+package libgogitdumper
+
+import (
+	"errors"
+	"io"
+	"math/rand"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// RetryTransport retries requests that fail with a connection error or a transient status (408, 429, 502, 503, 504).
+// It backs off exponentially with jitter, and waits as long as the server asks with Retry-After (up to MaxRetryAfter).
+type RetryTransport struct {
+	Next          http.RoundTripper
+	Retries       int           //extra attempts after the first
+	BaseDelay     time.Duration //delay before the first retry, doubled each time after
+	MaxDelay      time.Duration //cap on the backoff delay
+	MaxRetryAfter time.Duration //cap on how long a Retry-After can make us wait
+}
+
+// NewRetryTransport wraps next, retrying up to retries times starting from a base delay
+func NewRetryTransport(next http.RoundTripper, retries int, base time.Duration) *RetryTransport {
+	return &RetryTransport{
+		Next:          next,
+		Retries:       retries,
+		BaseDelay:     base,
+		MaxDelay:      30 * time.Second,
+		MaxRetryAfter: 2 * time.Minute,
+	}
+}
+
+func (r *RetryTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	for attempt := 0; ; attempt++ {
+		if attempt > 0 && req.Body != nil {
+			//requests with a body can only be resent if we can get the body again
+			body, err := req.GetBody()
+			if err != nil {
+				return nil, err
+			}
+			req = req.Clone(req.Context())
+			req.Body = body
+		}
+
+		resp, err := r.Next.RoundTrip(req)
+		if attempt >= r.Retries || !retryable(resp, err) || req.Context().Err() != nil || (req.Body != nil && req.GetBody == nil) {
+			return resp, err
+		}
+
+		delay := r.backoff(attempt)
+		if resp != nil {
+			if after, ok := retryAfter(resp); ok {
+				delay = after
+				if delay > r.MaxRetryAfter {
+					delay = r.MaxRetryAfter
+				}
+			}
+			//drain a little so the connection can be reused
+			io.Copy(io.Discard, io.LimitReader(resp.Body, 64<<10))
+			resp.Body.Close()
+		}
+
+		timer := time.NewTimer(delay)
+		select {
+		case <-req.Context().Done():
+			timer.Stop()
+			return nil, req.Context().Err()
+		case <-timer.C:
+		}
+	}
+}
+
+// backoff is base*2^attempt capped at MaxDelay, with the top half jittered so a burst of failures doesn't retry in lockstep
+func (r *RetryTransport) backoff(attempt int) time.Duration {
+	d := r.BaseDelay
+	for i := 0; i < attempt && d < r.MaxDelay; i++ {
+		d *= 2
+	}
+	if d > r.MaxDelay {
+		d = r.MaxDelay
+	}
+	if d <= 0 {
+		return 0
+	}
+	return d/2 + time.Duration(rand.Int63n(int64(d/2)+1))
+}
+
+func retryable(resp *http.Response, err error) bool {
+	if err != nil {
+		return !errors.Is(err, ErrNoProxies) && !errors.Is(err, ErrTooLarge)
+	}
+	return TransientStatus(resp.StatusCode)
+}
+
+// TransientStatus is true for status codes that are worth asking again for later
+func TransientStatus(code int) bool {
+	switch code {
+	case 408, 429, 502, 503, 504:
+		return true
+	}
+	return false
+}
+
+// retryAfter reads a Retry-After header, in either the seconds or the http date form
+func retryAfter(resp *http.Response) (time.Duration, bool) {
+	v := resp.Header.Get("Retry-After")
+	if v == "" {
+		return 0, false
+	}
+	if secs, err := strconv.Atoi(v); err == nil && secs >= 0 {
+		return time.Duration(secs) * time.Second, true
+	}
+	if t, err := http.ParseTime(v); err == nil {
+		d := time.Until(t)
+		if d < 0 {
+			d = 0
+		}
+		return d, true
+	}
+	return 0, false
+}
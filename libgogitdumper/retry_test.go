@@ -0,0 +1,145 @@
+package libgogitdumper
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestRetryAfter(t *testing.T) {
+	tests := []struct {
+		header string
+		want   time.Duration
+		ok     bool
+	}{
+		{"", 0, false},
+		{"0", 0, true},
+		{"120", 2 * time.Minute, true},
+		{"-5", 0, false},
+		{"soon", 0, false},
+		{"1.5", 0, false},
+		{time.Now().Add(-time.Hour).UTC().Format(http.TimeFormat), 0, true}, //already passed
+		{"Wed, 21 Oct 2015 07:28:00 GMT", 0, true},
+	}
+	for _, tt := range tests {
+		resp := &http.Response{Header: http.Header{"Retry-After": {tt.header}}}
+		got, ok := retryAfter(resp)
+		if got != tt.want || ok != tt.ok {
+			t.Errorf("%q: got %v %v, want %v %v", tt.header, got, ok, tt.want, tt.ok)
+		}
+	}
+
+	//dates in the future are however long until then
+	resp := &http.Response{Header: http.Header{"Retry-After": {time.Now().Add(time.Minute).UTC().Format(http.TimeFormat)}}}
+	if got, ok := retryAfter(resp); !ok || got < 55*time.Second || got > time.Minute {
+		t.Errorf("got %v %v for a date a minute away", got, ok)
+	}
+}
+
+func TestBackoff(t *testing.T) {
+	r := &RetryTransport{BaseDelay: 100 * time.Millisecond, MaxDelay: time.Second}
+	tests := []struct {
+		attempt int
+		max     time.Duration
+	}{
+		{0, 100 * time.Millisecond},
+		{1, 200 * time.Millisecond},
+		{2, 400 * time.Millisecond},
+		{3, 800 * time.Millisecond},
+		{4, time.Second},
+		{50, time.Second},
+	}
+	for _, tt := range tests {
+		//jittered over the top half, so anywhere from max/2 to max
+		for i := 0; i < 50; i++ {
+			if got := r.backoff(tt.attempt); got < tt.max/2 || got > tt.max {
+				t.Fatalf("attempt %d: got %v, want %v-%v", tt.attempt, got, tt.max/2, tt.max)
+			}
+		}
+	}
+
+	r.BaseDelay = 0
+	if got := r.backoff(3); got != 0 {
+		t.Errorf("got %v with no base delay", got)
+	}
+}
+
+func TestRetryTransport(t *testing.T) {
+	tests := []struct {
+		name     string
+		failures int32 //how many times to fail before answering properly
+		status   int
+		retries  int
+		want     int //final status
+		requests int32
+	}{
+		{"recovers", 2, 503, 3, 200, 3},
+		{"gives up", 10, 503, 2, 503, 3},
+		{"rate limited", 1, 429, 3, 200, 2},
+		{"not transient", 10, 404, 3, 404, 1},
+		{"server error", 10, 500, 3, 500, 1},
+		{"no retries", 10, 502, 0, 502, 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var requests int32
+			ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				body, _ := io.ReadAll(r.Body)
+				if r.Method == "POST" && string(body) != "payload" {
+					t.Errorf("attempt %d got body %q", atomic.LoadInt32(&requests)+1, body)
+				}
+				if atomic.AddInt32(&requests, 1) <= tt.failures {
+					w.Header().Set("Retry-After", "0")
+					w.WriteHeader(tt.status)
+					return
+				}
+				io.WriteString(w, "ok")
+			}))
+			defer ts.Close()
+
+			client := &http.Client{Transport: NewRetryTransport(ts.Client().Transport, tt.retries, time.Hour)} //Retry-After: 0 beats the delay
+			for _, method := range []string{"GET", "POST"} {
+				atomic.StoreInt32(&requests, 0)
+				req, _ := http.NewRequest(method, ts.URL, nil)
+				if method == "POST" {
+					req, _ = http.NewRequest(method, ts.URL, strings.NewReader("payload"))
+				}
+				resp, err := client.Do(req)
+				if err != nil {
+					t.Fatal(err)
+				}
+				resp.Body.Close()
+				if resp.StatusCode != tt.want || atomic.LoadInt32(&requests) != tt.requests {
+					t.Errorf("%s: got %d after %d requests, want %d after %d", method, resp.StatusCode, atomic.LoadInt32(&requests), tt.want, tt.requests)
+				}
+			}
+		})
+	}
+}
+
+func TestRetryTransportConnectionErrors(t *testing.T) {
+	ts := httptest.NewServer(http.NotFoundHandler())
+	dead := ts.URL
+	ts.Close()
+
+	var attempts int32
+	counting := roundTripFunc(func(req *http.Request) (*http.Response, error) {
+		atomic.AddInt32(&attempts, 1)
+		return http.DefaultTransport.RoundTrip(req)
+	})
+	client := &http.Client{Transport: NewRetryTransport(counting, 2, time.Millisecond)}
+	if _, err := client.Get(dead); err == nil {
+		t.Fatal("expected an error from a closed server")
+	}
+	if attempts != 3 {
+		t.Errorf("made %d attempts, want 3", attempts)
+	}
+}
+
+type roundTripFunc func(*http.Request) (*http.Response, error)
+
+func (f roundTripFunc) RoundTrip(req *http.Request) (*http.Response, error) { return f(req) }
@@ -0,0 +1,69 @@
+package libgogitdumper
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+)
+
+// ErrTooLarge is returned when a response goes over the per-file size limit
+var ErrTooLarge = errors.New("response too large")
+
+// ErrTotalLimit is returned once a dump has written as much as it's allowed to
+var ErrTotalLimit = errors.New("total size limit reached")
+
+// SizeLimitTransport stops any one response body going over Max bytes, so a huge pack or a hostile endless response can't eat all the memory or disk.
+// Responses that say they're too big up front are refused without reading them. A partial (206) response only gets what's left of Max after
+// the bytes before its range, so a download that keeps getting resumed can't grow past the limit either.
+type SizeLimitTransport struct {
+	Next http.RoundTripper
+	Max  int64
+}
+
+// NewSizeLimitTransport wraps next, capping bodies at max bytes (0 is unlimited)
+func NewSizeLimitTransport(next http.RoundTripper, max int64) *SizeLimitTransport {
+	return &SizeLimitTransport{Next: next, Max: max}
+}
+
+func (s *SizeLimitTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	resp, err := s.Next.RoundTrip(req)
+	if err != nil || s.Max <= 0 {
+		return resp, err
+	}
+	left := s.Max
+	if resp.StatusCode == 206 {
+		if start, ok := contentRangeStart(resp.Header.Get("Content-Range")); ok && start > 0 {
+			left -= start
+		}
+	}
+	if resp.ContentLength > left || left <= 0 {
+		resp.Body.Close()
+		return nil, fmt.Errorf("%w (%d bytes, the limit is %d)", ErrTooLarge, resp.ContentLength, s.Max)
+	}
+	resp.Body = &limitedBody{ReadCloser: resp.Body, left: left}
+	return resp, nil
+}
+
+// limitedBody errors with ErrTooLarge rather than quietly truncating like io.LimitReader, so a cut off file never gets saved as if it was whole
+type limitedBody struct {
+	io.ReadCloser
+	left int64
+}
+
+func (b *limitedBody) Read(p []byte) (int, error) {
+	if b.left <= 0 {
+		//exactly at the limit is fine, as long as that's the end
+		var one [1]byte
+		if n, _ := io.ReadFull(b.ReadCloser, one[:]); n > 0 {
+			return 0, ErrTooLarge
+		}
+		return 0, io.EOF
+	}
+	if int64(len(p)) > b.left {
+		p = p[:b.left]
+	}
+	n, err := b.ReadCloser.Read(p)
+	b.left -= int64(n)
+	return n, err
+}
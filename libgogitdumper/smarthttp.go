@@ -0,0 +1,384 @@
+package libgogitdumper
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// ErrNotSmart is returned by ProbeSmartHTTP when the server only serves the repo as static files
+var ErrNotSmart = errors.New("server does not speak smart http")
+
+// ErrNoGit is returned by IndexPack when there's no git on the PATH to run
+var ErrNoGit = errors.New("git not found on the PATH")
+
+const zeroSha1 = "0000000000000000000000000000000000000000"
+
+// SmartRemote is a git-upload-pack endpoint that has been probed and had its refs advertised
+type SmartRemote struct {
+	URL          string //the .git/ url, with trailing slash
+	Version      int    //0 or 2
+	Capabilities []string
+	Refs         []Ref
+	Head         string //what HEAD points at, if the server told us
+
+	client *http.Client
+}
+
+// ProbeSmartHTTP checks if baseURL is served by git http-backend (or similar) and grabs the advertised refs if so
+func ProbeSmartHTTP(baseURL string, client *http.Client) (*SmartRemote, error) {
+	request, err := http.NewRequest("GET", baseURL+"info/refs?service=git-upload-pack", nil)
+	if err != nil {
+		return nil, err
+	}
+	//ask for v2, servers that don't know about it will ignore this and give us v0
+	request.Header.Set("Git-Protocol", "version=2")
+	resp, err := client.Do(request)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != 200 || resp.Header.Get("Content-Type") != "application/x-git-upload-pack-advertisement" {
+		return nil, ErrNotSmart
+	}
+
+	remote := &SmartRemote{URL: baseURL, client: client}
+	rdr := bufio.NewReader(resp.Body)
+
+	pkt, special, err := readPktLine(rdr)
+	if err != nil {
+		return nil, err
+	}
+	//the smart http advertisement starts with a service line and a flush, which the git:// protocol doesn't have
+	if special < 0 && strings.HasPrefix(string(pkt), "# service=") {
+		for special < 0 {
+			pkt, special, err = readPktLine(rdr)
+			if err != nil {
+				return nil, err
+			}
+		}
+		pkt, special, err = readPktLine(rdr)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if special < 0 && string(bytes.TrimSpace(pkt)) == "version 2" {
+		remote.Version = 2
+		for {
+			pkt, special, err = readPktLine(rdr)
+			if err != nil {
+				return nil, err
+			}
+			if special >= 0 {
+				break
+			}
+			remote.Capabilities = append(remote.Capabilities, string(bytes.TrimSpace(pkt)))
+		}
+		err = remote.lsRefs()
+		if err != nil {
+			return nil, err
+		}
+		return remote, nil
+	}
+
+	//v0 - refs until the flush, capabilities hidden behind a null on the first line
+	for special < 0 {
+		line := string(bytes.TrimSuffix(pkt, []byte("\n")))
+		if i := strings.IndexByte(line, 0); i >= 0 {
+			remote.Capabilities = strings.Fields(line[i+1:])
+			line = line[:i]
+		}
+		parts := strings.SplitN(line, " ", 2)
+		if len(parts) == 2 && parts[0] != zeroSha1 {
+			r := Ref{Sha1: parts[0], Name: parts[1]}
+			if strings.HasSuffix(r.Name, "^{}") {
+				r.Name = strings.TrimSuffix(r.Name, "^{}")
+				r.Peeled = true
+			}
+			remote.Refs = append(remote.Refs, r)
+		}
+		pkt, special, err = readPktLine(rdr)
+		if err != nil {
+			return nil, err
+		}
+	}
+	for _, x := range remote.Capabilities {
+		if strings.HasPrefix(x, "symref=HEAD:") {
+			remote.Head = strings.TrimPrefix(x, "symref=HEAD:")
+		}
+	}
+
+	return remote, nil
+}
+
+// lsRefs asks a v2 server for its refs, since v2 doesn't advertise them up front
+func (s *SmartRemote) lsRefs() error {
+	body := &bytes.Buffer{}
+	body.Write(pktLine("command=ls-refs\n"))
+	body.WriteString("0001")
+	body.Write(pktLine("peel\n"))
+	body.Write(pktLine("symrefs\n"))
+	body.WriteString("0000")
+
+	resp, err := s.post(body.Bytes())
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	rdr := bufio.NewReader(resp.Body)
+	for {
+		pkt, special, err := readPktLine(rdr)
+		if err != nil {
+			return err
+		}
+		if special >= 0 {
+			break
+		}
+		//<oid> <refname> [symref-target:<target>] [peeled:<oid>]
+		fields := strings.Fields(string(pkt))
+		if len(fields) < 2 || fields[0] == "unborn" {
+			continue
+		}
+		s.Refs = append(s.Refs, Ref{Sha1: fields[0], Name: fields[1]})
+		for _, attr := range fields[2:] {
+			if strings.HasPrefix(attr, "peeled:") {
+				s.Refs = append(s.Refs, Ref{Sha1: strings.TrimPrefix(attr, "peeled:"), Name: fields[1], Peeled: true})
+			}
+			if fields[1] == "HEAD" && strings.HasPrefix(attr, "symref-target:") {
+				s.Head = strings.TrimPrefix(attr, "symref-target:")
+			}
+		}
+	}
+	return nil
+}
+
+// FetchPack wants every advertised ref, and streams the packfile the server sends back to out. It returns the pack's name.
+func (s *SmartRemote) FetchPack(out io.Writer) (string, error) {
+	wants := []string{}
+	seen := map[string]bool{}
+	for _, x := range s.Refs {
+		if x.Peeled || seen[x.Sha1] {
+			continue
+		}
+		seen[x.Sha1] = true
+		wants = append(wants, x.Sha1)
+	}
+	if len(wants) == 0 {
+		return "", errors.New("no refs advertised, nothing to fetch")
+	}
+
+	body := &bytes.Buffer{}
+	if s.Version == 2 {
+		body.Write(pktLine("command=fetch\n"))
+		body.WriteString("0001")
+		body.Write(pktLine("no-progress\n"))
+		body.Write(pktLine("ofs-delta\n"))
+		for _, x := range wants {
+			body.Write(pktLine("want " + x + "\n"))
+		}
+		body.Write(pktLine("done\n"))
+		body.WriteString("0000")
+	} else {
+		caps := []string{}
+		for _, x := range []string{"side-band-64k", "ofs-delta", "no-progress"} {
+			if s.hasCapability(x) {
+				caps = append(caps, x)
+			}
+		}
+		for i, x := range wants {
+			line := "want " + x
+			if i == 0 && len(caps) > 0 {
+				line += " " + strings.Join(caps, " ")
+			}
+			body.Write(pktLine(line + "\n"))
+		}
+		body.WriteString("0000")
+		body.Write(pktLine("done\n"))
+	}
+
+	resp, err := s.post(body.Bytes())
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	rdr := bufio.NewReader(resp.Body)
+
+	sideband := true
+	if s.Version == 2 {
+		//skip any sections before the packfile (we said done, so there shouldn't be any acks)
+		for {
+			pkt, special, err := readPktLine(rdr)
+			if err != nil {
+				return "", err
+			}
+			if special < 0 && string(bytes.TrimSpace(pkt)) == "packfile" {
+				break
+			}
+		}
+	} else {
+		//NAK, since we didn't send any haves
+		pkt, _, err := readPktLine(rdr)
+		if err != nil {
+			return "", err
+		}
+		if !bytes.HasPrefix(pkt, []byte("NAK")) && !bytes.HasPrefix(pkt, []byte("ACK")) {
+			return "", fmt.Errorf("unexpected upload-pack response: %q", pkt)
+		}
+		sideband = s.hasCapability("side-band-64k")
+	}
+
+	pack := &packWriter{out: out}
+	if sideband {
+		err = demuxSideband(rdr, pack)
+	} else {
+		_, err = io.Copy(pack, rdr)
+	}
+	if err != nil {
+		return "", err
+	}
+	if !bytes.HasPrefix(pack.head, []byte("PACK")) || pack.n < 32 {
+		return "", errors.New("server did not send a valid packfile")
+	}
+	return PackName(pack.tail), nil
+}
+
+// PackName is the name git would give the pack (from its trailing checksum)
+func PackName(pack []byte) string {
+	if len(pack) < 20 {
+		return ""
+	}
+	return hex.EncodeToString(pack[len(pack)-20:])
+}
+
+// IndexPack runs git index-pack on a downloaded pack, writing its .idx alongside so the repo can be used straight away
+func IndexPack(packpath string) error {
+	git, err := exec.LookPath("git")
+	if err != nil {
+		return ErrNoGit
+	}
+	packpath, err = filepath.Abs(packpath)
+	if err != nil {
+		return err
+	}
+	cmd := exec.Command(git, "index-pack", packpath)
+	//run from the pack dir with the ceiling just above it, so git doesn't find the dumped repo and read its (server supplied) config
+	cmd.Dir = filepath.Dir(packpath)
+	cmd.Env = append(os.Environ(), "GIT_CEILING_DIRECTORIES="+filepath.Dir(cmd.Dir))
+	if out, err := cmd.CombinedOutput(); err != nil {
+		return fmt.Errorf("git index-pack: %v: %s", err, bytes.TrimSpace(out))
+	}
+	return nil
+}
+
+// packWriter passes the pack through, keeping just enough of it to check the signature and get the trailing checksum
+type packWriter struct {
+	out  io.Writer
+	n    int64
+	head []byte
+	tail []byte
+}
+
+func (p *packWriter) Write(b []byte) (int, error) {
+	if need := 4 - len(p.head); need > 0 {
+		if need > len(b) {
+			need = len(b)
+		}
+		p.head = append(p.head, b[:need]...)
+	}
+	p.tail = append(p.tail, b...)
+	if len(p.tail) > 20 {
+		p.tail = append(p.tail[:0], p.tail[len(p.tail)-20:]...)
+	}
+	n, err := p.out.Write(b)
+	p.n += int64(n)
+	return n, err
+}
+
+func (s *SmartRemote) hasCapability(c string) bool {
+	for _, x := range s.Capabilities {
+		if x == c || strings.HasPrefix(x, c+"=") {
+			return true
+		}
+	}
+	return false
+}
+
+func (s *SmartRemote) post(body []byte) (*http.Response, error) {
+	request, err := http.NewRequest("POST", s.URL+"git-upload-pack", bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	request.Header.Set("Content-Type", "application/x-git-upload-pack-request")
+	request.Header.Set("Accept", "application/x-git-upload-pack-result")
+	if s.Version == 2 {
+		request.Header.Set("Git-Protocol", "version=2")
+	}
+	resp, err := s.client.Do(request)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != 200 {
+		resp.Body.Close()
+		return nil, fmt.Errorf("Error code: %d", resp.StatusCode)
+	}
+	return resp, nil
+}
+
+func demuxSideband(rdr io.Reader, out io.Writer) error {
+	for {
+		pkt, special, err := readPktLine(rdr)
+		if err != nil {
+			return err
+		}
+		if special >= 0 {
+			return nil
+		}
+		if len(pkt) == 0 {
+			continue
+		}
+		switch pkt[0] {
+		case 1: //pack data
+			if _, err := out.Write(pkt[1:]); err != nil {
+				return err
+			}
+		case 2: //progress, don't care
+		case 3:
+			return errors.New("remote error: " + string(bytes.TrimSpace(pkt[1:])))
+		}
+	}
+}
+
+func pktLine(s string) []byte {
+	return []byte(fmt.Sprintf("%04x%s", len(s)+4, s))
+}
+
+// readPktLine reads one pkt-line. special is -1 for normal lines, otherwise 0 (flush), 1 (delim) or 2 (response end)
+func readPktLine(rdr io.Reader) ([]byte, int, error) {
+	lenbuf := make([]byte, 4)
+	if _, err := io.ReadFull(rdr, lenbuf); err != nil {
+		return nil, 0, err
+	}
+	l, err := strconv.ParseUint(string(lenbuf), 16, 16)
+	if err != nil {
+		return nil, 0, fmt.Errorf("bad pkt-line length %q", lenbuf)
+	}
+	if l < 4 {
+		return nil, int(l), nil
+	}
+	pkt := make([]byte, l-4)
+	if _, err := io.ReadFull(rdr, pkt); err != nil {
+		return nil, 0, err
+	}
+	return pkt, -1, nil
+}
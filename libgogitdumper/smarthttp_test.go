@@ -0,0 +1,337 @@
+package libgogitdumper
+
+import (
+	"bufio"
+	"bytes"
+	"compress/zlib"
+	"crypto/sha1"
+	"encoding/hex"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+const (
+	mainSha = "1111111111111111111111111111111111111111"
+	tagSha  = "2222222222222222222222222222222222222222"
+	peelSha = "3333333333333333333333333333333333333333"
+)
+
+// fakePack is enough of a packfile for FetchPack: the signature, a header and a trailing checksum
+func fakePack() []byte {
+	body := append([]byte("PACK\x00\x00\x00\x02\x00\x00\x00\x00"), bytes.Repeat([]byte{0xaa}, 40)...)
+	sum := sha1.Sum(body)
+	return append(body, sum[:]...)
+}
+
+// sideband wraps data up in band 1 pkt-lines, a few bytes at a time so it gets split over several
+func sideband(data []byte, chunk int) []byte {
+	out := &bytes.Buffer{}
+	for len(data) > 0 {
+		n := chunk
+		if n > len(data) {
+			n = len(data)
+		}
+		out.Write(pktLine("\x01" + string(data[:n])))
+		data = data[n:]
+	}
+	return out.Bytes()
+}
+
+// fakeUploadPack stands in for git http-backend, speaking v0 or v2 (if the client asks for it and v2 is set)
+type fakeUploadPack struct {
+	v2       bool
+	sideband bool
+	pack     []byte
+	requests []string //the request bodies, for checking what was asked for
+}
+
+func (f *fakeUploadPack) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	v2 := f.v2 && r.Header.Get("Git-Protocol") == "version=2"
+	switch {
+	case r.Method == "GET" && strings.HasSuffix(r.URL.Path, "/info/refs") && r.URL.Query().Get("service") == "git-upload-pack":
+		w.Header().Set("Content-Type", "application/x-git-upload-pack-advertisement")
+		w.Write(pktLine("# service=git-upload-pack\n"))
+		io.WriteString(w, "0000")
+		if v2 {
+			w.Write(pktLine("version 2\n"))
+			w.Write(pktLine("agent=git/2.40.0\n"))
+			w.Write(pktLine("ls-refs=unborn\n"))
+			w.Write(pktLine("fetch=shallow\n"))
+			io.WriteString(w, "0000")
+			return
+		}
+		caps := "multi_ack ofs-delta symref=HEAD:refs/heads/main agent=git/2.40.0"
+		if f.sideband {
+			caps = "side-band-64k " + caps
+		}
+		w.Write(pktLine(mainSha + " HEAD\x00" + caps + "\n"))
+		w.Write(pktLine(mainSha + " refs/heads/main\n"))
+		w.Write(pktLine(tagSha + " refs/tags/v1\n"))
+		w.Write(pktLine(peelSha + " refs/tags/v1^{}\n"))
+		io.WriteString(w, "0000")
+
+	case r.Method == "POST" && strings.HasSuffix(r.URL.Path, "/git-upload-pack"):
+		body, _ := io.ReadAll(r.Body)
+		f.requests = append(f.requests, string(body))
+		w.Header().Set("Content-Type", "application/x-git-upload-pack-result")
+		switch {
+		case v2 && bytes.Contains(body, []byte("command=ls-refs")):
+			w.Write(pktLine(mainSha + " HEAD symref-target:refs/heads/main\n"))
+			w.Write(pktLine(mainSha + " refs/heads/main\n"))
+			w.Write(pktLine(tagSha + " refs/tags/v1 peeled:" + peelSha + "\n"))
+			w.Write(pktLine("unborn refs/heads/empty\n"))
+			io.WriteString(w, "0000")
+		case v2 && bytes.Contains(body, []byte("command=fetch")):
+			w.Write(pktLine("packfile\n"))
+			w.Write(pktLine("\x02Enumerating objects: 3, done.\n"))
+			w.Write(sideband(f.pack, 7))
+			io.WriteString(w, "0000")
+		default:
+			w.Write(pktLine("NAK\n"))
+			if f.sideband {
+				w.Write(pktLine("\x02Counting objects: 3\n"))
+				w.Write(sideband(f.pack, 7))
+				io.WriteString(w, "0000")
+			} else {
+				w.Write(f.pack)
+			}
+		}
+
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+func TestReadPktLine(t *testing.T) {
+	rdr := bufio.NewReader(strings.NewReader("000ahello\n" + "0000" + "0001" + "0002" + "0004" + "zzzz"))
+	tests := []struct {
+		pkt     string
+		special int
+	}{
+		{"hello\n", -1},
+		{"", 0},
+		{"", 1},
+		{"", 2},
+		{"", -1}, //0004 is an empty line, not a special one
+	}
+	for i, tt := range tests {
+		pkt, special, err := readPktLine(rdr)
+		if err != nil {
+			t.Fatalf("line %d: %v", i, err)
+		}
+		if string(pkt) != tt.pkt || special != tt.special {
+			t.Errorf("line %d: got %q %d, want %q %d", i, pkt, special, tt.pkt, tt.special)
+		}
+	}
+	if _, _, err := readPktLine(rdr); err == nil {
+		t.Error("bad length should be an error")
+	}
+	if _, _, err := readPktLine(strings.NewReader("0010short")); err == nil {
+		t.Error("truncated line should be an error")
+	}
+	if _, _, err := readPktLine(strings.NewReader("")); err != io.EOF {
+		t.Errorf("got %v at the end, want EOF", err)
+	}
+}
+
+func TestPktLine(t *testing.T) {
+	if got := string(pktLine("done\n")); got != "0009done\n" {
+		t.Errorf("got %q", got)
+	}
+}
+
+func TestDemuxSideband(t *testing.T) {
+	in := &bytes.Buffer{}
+	in.Write(pktLine("\x01abc"))
+	in.Write(pktLine("\x02progress, ignored\n"))
+	in.WriteString("0004") //empty line
+	in.Write(pktLine("\x01def"))
+	in.WriteString("0000")
+	in.Write(pktLine("\x01after the flush"))
+	out := &bytes.Buffer{}
+	if err := demuxSideband(in, out); err != nil {
+		t.Fatal(err)
+	}
+	if out.String() != "abcdef" {
+		t.Errorf("got %q, want abcdef", out.String())
+	}
+
+	in.Reset()
+	in.Write(pktLine("\x01abc"))
+	in.Write(pktLine("\x03upload-pack: not our ref\n"))
+	if err := demuxSideband(in, io.Discard); err == nil || !strings.Contains(err.Error(), "not our ref") {
+		t.Errorf("got %v, want the remote error", err)
+	}
+
+	in.Reset()
+	in.Write(pktLine("\x01abc"))
+	if err := demuxSideband(in, io.Discard); err != io.EOF {
+		t.Errorf("got %v for a stream without a flush, want EOF", err)
+	}
+
+	in.Reset()
+	in.Write(pktLine("\x01abc"))
+	werr := errors.New("disk full")
+	if err := demuxSideband(in, failWriter{werr}); err != werr {
+		t.Errorf("got %v, want the write error", err)
+	}
+}
+
+type failWriter struct{ err error }
+
+func (f failWriter) Write([]byte) (int, error) { return 0, f.err }
+
+func TestProbeSmartHTTP(t *testing.T) {
+	wantRefs := []Ref{
+		{Sha1: mainSha, Name: "HEAD"},
+		{Sha1: mainSha, Name: "refs/heads/main"},
+		{Sha1: tagSha, Name: "refs/tags/v1"},
+		{Sha1: peelSha, Name: "refs/tags/v1", Peeled: true},
+	}
+	for _, v2 := range []bool{false, true} {
+		ts := httptest.NewServer(&fakeUploadPack{v2: v2, sideband: true})
+		remote, err := ProbeSmartHTTP(ts.URL+"/repo.git/", ts.Client())
+		ts.Close()
+		if err != nil {
+			t.Fatalf("v2=%v: %v", v2, err)
+		}
+		wantVersion := 0
+		if v2 {
+			wantVersion = 2
+		}
+		if remote.Version != wantVersion {
+			t.Errorf("v2=%v: got version %d", v2, remote.Version)
+		}
+		if !reflect.DeepEqual(remote.Refs, wantRefs) {
+			t.Errorf("v2=%v: got refs %+v, want %+v", v2, remote.Refs, wantRefs)
+		}
+		if remote.Head != "refs/heads/main" {
+			t.Errorf("v2=%v: got HEAD %q", v2, remote.Head)
+		}
+		if !v2 && !remote.hasCapability("side-band-64k") {
+			t.Errorf("v0 capabilities not parsed: %q", remote.Capabilities)
+		}
+		if v2 && !remote.hasCapability("fetch") {
+			t.Errorf("v2 capabilities not parsed: %q", remote.Capabilities)
+		}
+	}
+}
+
+func TestProbeSmartHTTPNotSmart(t *testing.T) {
+	//a static file server just hands back the dumb info/refs
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/plain")
+		io.WriteString(w, mainSha+"\trefs/heads/main\n")
+	}))
+	defer ts.Close()
+	if _, err := ProbeSmartHTTP(ts.URL+"/repo.git/", ts.Client()); err != ErrNotSmart {
+		t.Errorf("got %v, want ErrNotSmart", err)
+	}
+}
+
+func TestFetchPack(t *testing.T) {
+	pack := fakePack()
+	wantName := hex.EncodeToString(pack[len(pack)-20:])
+	tests := []struct {
+		name     string
+		v2       bool
+		sideband bool
+	}{
+		{"v0 sideband", false, true},
+		{"v0 raw", false, false},
+		{"v2", true, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f := &fakeUploadPack{v2: tt.v2, sideband: tt.sideband, pack: pack}
+			ts := httptest.NewServer(f)
+			defer ts.Close()
+
+			remote, err := ProbeSmartHTTP(ts.URL+"/repo.git/", ts.Client())
+			if err != nil {
+				t.Fatal(err)
+			}
+			out := &bytes.Buffer{}
+			name, err := remote.FetchPack(out)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if name != wantName {
+				t.Errorf("got pack name %s, want %s", name, wantName)
+			}
+			if !bytes.Equal(out.Bytes(), pack) {
+				t.Errorf("pack doesn't match, got %d bytes want %d", out.Len(), len(pack))
+			}
+
+			//every ref wanted once, peeled tags aren't wanted separately
+			req := f.requests[len(f.requests)-1]
+			for _, x := range []string{mainSha, tagSha} {
+				if n := strings.Count(req, "want "+x); n != 1 {
+					t.Errorf("%s wanted %d times", x, n)
+				}
+			}
+			if strings.Contains(req, "want "+peelSha) {
+				t.Error("peeled sha wanted")
+			}
+			if tt.v2 != strings.Contains(req, "command=fetch") {
+				t.Errorf("wrong request for the protocol version: %q", req)
+			}
+		})
+	}
+}
+
+func TestFetchPackNotAPack(t *testing.T) {
+	ts := httptest.NewServer(&fakeUploadPack{sideband: true, pack: []byte("<html>nope</html>")})
+	defer ts.Close()
+	remote, err := ProbeSmartHTTP(ts.URL+"/repo.git/", ts.Client())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := remote.FetchPack(io.Discard); err == nil {
+		t.Error("expected an error for something that isn't a packfile")
+	}
+}
+
+// blobPack is a real pack holding the single blob "hello\n"
+func blobPack() []byte {
+	var z bytes.Buffer
+	w := zlib.NewWriter(&z)
+	w.Write([]byte("hello\n"))
+	w.Close()
+	body := append([]byte("PACK\x00\x00\x00\x02\x00\x00\x00\x01\x36"), z.Bytes()...) //one object, type 3 (blob) size 6
+	sum := sha1.Sum(body)
+	return append(body, sum[:]...)
+}
+
+func TestIndexPack(t *testing.T) {
+	if _, err := exec.LookPath("git"); err != nil {
+		if IndexPack("whatever.pack") != ErrNoGit {
+			t.Error("expected ErrNoGit without git on the PATH")
+		}
+		t.Skip("git not installed")
+	}
+	dir := t.TempDir()
+	pack := blobPack()
+	packpath := filepath.Join(dir, "pack-"+PackName(pack)+".pack")
+	os.WriteFile(packpath, pack, 0644)
+	if err := IndexPack(packpath); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(strings.TrimSuffix(packpath, ".pack") + ".idx"); err != nil {
+		t.Error("no index written:", err)
+	}
+
+	badpath := filepath.Join(dir, "pack-bad.pack")
+	os.WriteFile(badpath, fakePack(), 0644)
+	if err := IndexPack(badpath); err == nil {
+		t.Error("expected an error for a broken pack")
+	}
+}
@@ -0,0 +1,128 @@
+package libgogitdumper
+
+import (
+	"bytes"
+	"crypto/rand"
+	"crypto/sha1"
+	"encoding/hex"
+	"errors"
+	"io"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strings"
+	"sync/atomic"
+)
+
+// ErrSoftNotFound is returned for responses that match the site's catch-all page
+var ErrSoftNotFound = errors.New("soft 404 (matches catch-all response)")
+
+// Fingerprint describes a response to a path that can't exist
+type Fingerprint struct {
+	Status int
+	Length int
+	Hash   string //sha1 of the body, with the requested path taken out (lots of error pages echo it back)
+	Title  string
+
+	normLength int //length with the path taken out, so the same page for a longer path is still the same length
+}
+
+// SoftNotFound holds the fingerprints of a site's catch-all responses, and counts how many responses it has rejected
+type SoftNotFound struct {
+	Fingerprints []Fingerprint
+	rejected     uint64
+}
+
+var titleRe = regexp.MustCompile(`(?is)<title[^>]*>(.*?)</title>`)
+
+// CalibrateSoftNotFound requests a few random paths that can't exist under the .git dir, and fingerprints any that come back as a 2xx
+func CalibrateSoftNotFound(gitURL string, client *http.Client) *SoftNotFound {
+	s := &SoftNotFound{}
+	r := randomHex(40)
+	for _, path := range []string{
+		gitURL + r[:12],
+		gitURL + "objects/" + r[:2] + "/" + r[2:],
+		gitURL + "refs/heads/" + r[:16],
+	} {
+		resp, err := client.Get(path)
+		if err != nil {
+			continue
+		}
+		body, err := io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+		resp.Body.Close()
+		if err != nil || resp.StatusCode < 200 || resp.StatusCode > 299 {
+			continue
+		}
+		if s.Matches(path, resp.StatusCode, body) {
+			//already got this one
+			continue
+		}
+		fp := fingerprint(path, body)
+		fp.Status = resp.StatusCode
+		s.Fingerprints = append(s.Fingerprints, fp)
+	}
+	s.rejected = 0
+	return s
+}
+
+// Matches checks a response against the catch-all fingerprints, counting it as rejected if it matches. The status has to match,
+// and then either the body hash, or the title as long as the length is close too (pages with a timestamp or token in them never hash the same).
+func (s *SoftNotFound) Matches(path string, status int, body []byte) bool {
+	if s == nil || len(s.Fingerprints) == 0 {
+		return false
+	}
+	fp := fingerprint(path, body)
+	for _, x := range s.Fingerprints {
+		if x.Status != status {
+			continue
+		}
+		if fp.Hash == x.Hash || (x.Title != "" && fp.Title == x.Title && lengthsClose(fp.normLength, x.normLength)) {
+			atomic.AddUint64(&s.rejected, 1)
+			return true
+		}
+	}
+	return false
+}
+
+// lengthsClose allows for a little dynamic content: within 64 bytes, or 10% for bigger pages
+func lengthsClose(a, b int) bool {
+	d := a - b
+	if d < 0 {
+		d = -d
+	}
+	return d <= 64 || d*10 <= b
+}
+
+// Rejected is how many responses have matched so far
+func (s *SoftNotFound) Rejected() uint64 {
+	if s == nil {
+		return 0
+	}
+	return atomic.LoadUint64(&s.rejected)
+}
+
+func fingerprint(path string, body []byte) Fingerprint {
+	fp := Fingerprint{Length: len(body)}
+	if m := titleRe.FindSubmatch(body); m != nil {
+		fp.Title = strings.TrimSpace(string(m[1]))
+	}
+	normalised := body
+	if u, err := url.Parse(path); err == nil {
+		//longest first, so the full path gets removed before the bits of it do
+		for _, x := range []string{u.RequestURI(), u.Path, u.Path[strings.LastIndex(u.Path, "/")+1:]} {
+			if x != "" && x != "/" {
+				normalised = bytes.ReplaceAll(normalised, []byte(x), nil)
+			}
+		}
+	}
+	h := sha1.Sum(normalised)
+	fp.Hash = hex.EncodeToString(h[:])
+	fp.normLength = len(normalised)
+	return fp
+}
+
+func randomHex(n int) string {
+	b := make([]byte, n/2)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
@@ -0,0 +1,63 @@
+package libgogitdumper
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+)
+
+const catchAllPage = `<html><head><title>Example Shop</title></head><body><p>Sorry, %s wasn't found.</p><input type="hidden" name="csrf" value="%d"></body></html>`
+
+func TestSoftNotFound(t *testing.T) {
+	var n int32
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		//a different token every time, so the hash never matches and it's down to the title and length
+		fmt.Fprintf(w, catchAllPage, r.URL.Path, 1000+atomic.AddInt32(&n, 1))
+	}))
+	defer ts.Close()
+	gitURL := ts.URL + "/.git/"
+
+	s := CalibrateSoftNotFound(gitURL, ts.Client())
+	if len(s.Fingerprints) == 0 {
+		t.Fatal("catch-all not fingerprinted")
+	}
+	if s.Rejected() != 0 {
+		t.Error("calibration counted as rejections")
+	}
+
+	tests := []struct {
+		name   string
+		path   string
+		status int
+		body   string
+		want   bool
+	}{
+		{"catch-all", gitURL + "refs/heads/main", 200, fmt.Sprintf(catchAllPage, "/.git/refs/heads/main", 2000), true},
+		{"catch-all for a long path", gitURL + "logs/refs/remotes/origin/a-very-long-branch-name", 200, fmt.Sprintf(catchAllPage, "/.git/logs/refs/remotes/origin/a-very-long-branch-name", 2000), true},
+		{"git file", gitURL + "HEAD", 200, "ref: refs/heads/main\n", false},
+		{"wrong status", gitURL + "refs/heads/main", 203, fmt.Sprintf(catchAllPage, "/.git/refs/heads/main", 2000), false},
+		//same title, but a real page with a lot more in it
+		{"same title", gitURL + "description", 200, "<html><head><title>Example Shop</title></head><body>" + strings.Repeat("<p>product</p>", 100) + "</body></html>", false},
+	}
+	for _, tt := range tests {
+		if got := s.Matches(tt.path, tt.status, []byte(tt.body)); got != tt.want {
+			t.Errorf("%s: got %v, want %v", tt.name, got, tt.want)
+		}
+	}
+	if s.Rejected() != 2 {
+		t.Errorf("counted %d rejections, want 2", s.Rejected())
+	}
+}
+
+func TestSoftNotFoundRealNotFound(t *testing.T) {
+	//sites with proper 404s don't get fingerprinted at all
+	ts := httptest.NewServer(http.NotFoundHandler())
+	defer ts.Close()
+	s := CalibrateSoftNotFound(ts.URL+"/.git/", ts.Client())
+	if len(s.Fingerprints) != 0 || s.Matches(ts.URL+"/.git/HEAD", 200, []byte("404 page not found\n")) {
+		t.Errorf("got fingerprints %+v", s.Fingerprints)
+	}
+}
@@ -2,14 +2,20 @@ package libgogitdumper
 
 import (
 	"bytes"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
 	"io"
+	"regexp"
 	"strconv"
 	"strings"
+	"time"
 )
 
 type Writeme struct {
 	LocalFilePath string
 	Filecontents  []byte
+	TempFilePath  string //already downloaded to here, just needs moving into place (Filecontents is ignored)
 }
 
 type Config struct {
@@ -19,6 +25,41 @@ type Config struct {
 	IndexBypass   bool
 	IndexLocation string
 	ProxyAddr     string
+	RefWordlist   string
+	SmartHTTP     bool
+	Force         bool
+	Check         bool
+
+	TargetList        string
+	ConcurrentTargets int
+	MaxRequests       int
+
+	Retries    int
+	RetryDelay time.Duration
+	Rate       float64
+	GlobalRate float64
+	Burst      int
+
+	Headers    []string
+	CookieFile string
+	Auth       string
+	AuthType   string
+	UserAgent  string
+
+	CertFile       string
+	KeyFile        string
+	PKCS12File     string
+	PKCS12Password string
+	CAFile         string
+	SNI            string
+	TLSMin         string
+	TLSMax         string
+
+	Resolve []string
+	Host    string
+
+	MaxFileMB  int64
+	MaxTotalMB int64
 }
 
 type IndexFile struct {
@@ -76,6 +117,30 @@ type PackIndex struct {
 	Header  [4]byte //should be 255,116,79,99
 	Version [4]byte //should be 0,0,0,2
 
+	Objects []string //every object in the matching pack
+}
+
+// ParsePackIndexFile reads the object names out of a v2 .idx file (header, 256 entry fanout table, then the sorted sha1s)
+func ParsePackIndexFile(b []byte) (PackIndex, error) {
+	ret := PackIndex{}
+	if len(b) < 8+256*4 {
+		return ret, errors.New("Bad pack index file")
+	}
+	copy(ret.Header[:], b[0:4])
+	copy(ret.Version[:], b[4:8])
+	if !bytes.Equal(ret.Header[:], []byte{255, 116, 79, 99}) || binary.BigEndian.Uint32(ret.Version[:]) != 2 {
+		return ret, errors.New("Bad pack index file")
+	}
+	//last fanout entry is the total object count
+	count := int(binary.BigEndian.Uint32(b[8+255*4 : 8+256*4]))
+	start := 8 + 256*4
+	if len(b) < start+count*20 {
+		return ret, errors.New("Bad pack index file")
+	}
+	for x := 0; x < count; x++ {
+		ret.Objects = append(ret.Objects, hex.EncodeToString(b[start+x*20:start+(x+1)*20]))
+	}
+	return ret, nil
 }
 
 type Tree struct {
@@ -85,6 +150,12 @@ type Tree struct {
 	TreeEntries []TreeEntry
 }
 
+// Commit is the bits of a commit object we care about for finding more objects
+type Commit struct {
+	Tree    string
+	Parents []string //for a stash, parent 2 is the index state and parent 3 is the untracked files
+}
+
 type TreeEntry struct {
 	Mode  [6]byte  //could be smaller but lol... roughly unix filemode
 	Delim [1]byte  //space :(
@@ -92,58 +163,114 @@ type TreeEntry struct {
 	Hash  [20]byte //sha1 (we want this badboi)
 }
 
-func ParseTreeFile(b []byte) Tree {
+// ParseTreeFile parses a decompressed tree object. Anything truncated or malformed is an error, it's all server controlled.
+func ParseTreeFile(b []byte) (Tree, error) {
 	rdr := bytes.NewReader(b)
 	ret := Tree{}
 
 	rdr.Read(ret.Header[:])
 	if bytes.Compare(ret.Header[:], []byte("tree")) != 0 {
-		panic("bad")
+		return ret, errors.New("Bad tree file")
 	}
 	rdr.Read(ret.Delim[:])
 	name, _ := readNullTerminated(rdr)
 	i, err := strconv.ParseInt(name, 0, 0)
 	if err != nil {
-		panic(err)
+		return ret, errors.New("Bad tree file: " + err.Error())
 	}
 	ret.Len = int(i)
 
-	ret.TreeEntries = parseTreeEntries(rdr, ret.Len)
+	ret.TreeEntries, err = parseTreeEntries(rdr, ret.Len)
+	return ret, err
+}
+
+// ParseCommitFile parses a decompressed commit object ("commit <len>\x00" followed by the headers and message)
+func ParseCommitFile(b []byte) (Commit, error) {
+	ret := Commit{}
+	i := bytes.IndexByte(b, 0)
+	if !bytes.HasPrefix(b, []byte("commit ")) || i < 0 {
+		return ret, errors.New("Bad commit file")
+	}
+	//headers go until the first blank line
+	for _, line := range strings.Split(string(b[i+1:]), "\n") {
+		if line == "" {
+			break
+		}
+		if strings.HasPrefix(line, "tree ") {
+			ret.Tree = strings.TrimPrefix(line, "tree ")
+		} else if strings.HasPrefix(line, "parent ") && sha1Re.MatchString(line[7:]) {
+			ret.Parents = append(ret.Parents, strings.TrimPrefix(line, "parent "))
+		}
+	}
+	if !sha1Re.MatchString(ret.Tree) {
+		return ret, errors.New("Bad commit file")
+	}
+	return ret, nil
+}
 
-	return ret
+// NoteTargets returns the objects annotated by a notes tree (entries named after the hash of the thing they annotate).
+// Big notes trees fan out (ab/cdef...), so prefix is the hex dir names leading down to this tree (empty for the top), and
+// subtrees that carry on the fanout come back as hash -> their prefix, so their entries can be joined up when they get parsed.
+func NoteTargets(t Tree, prefix string) (targets []string, subtrees map[string]string) {
+	targets = []string{}
+	subtrees = map[string]string{}
+	for _, x := range t.TreeEntries {
+		name := strings.ToLower(prefix + x.Name)
+		if !hexRe.MatchString(name) {
+			continue
+		}
+		if len(name) == 40 && !x.IsTree() {
+			targets = append(targets, name)
+		} else if len(name) < 40 && x.IsTree() {
+			subtrees[hex.EncodeToString(x.Hash[:])] = name
+		}
+	}
+	return targets, subtrees
 }
 
-func parseTreeEntries(rdr io.Reader, size int) []TreeEntry {
+// IsTree is true for subdirectory entries
+func (e TreeEntry) IsTree() bool {
+	return strings.TrimLeft(strings.TrimSpace(string(e.Mode[:])), "0") == "40000"
+}
+
+var hexRe = regexp.MustCompile("^[0-9a-f]+$")
+
+func parseTreeEntries(rdr io.Reader, size int) ([]TreeEntry, error) {
 	ret := []TreeEntry{}
 	read := 0
 	for read < size {
 		entry := TreeEntry{}
-		n, err := rdr.Read(entry.Mode[:])
+		n, err := io.ReadFull(rdr, entry.Mode[:])
 		read += n
 		if err != nil {
-			panic(err)
+			return ret, errors.New("Bad tree file: truncated entry")
 		}
 
-		n, err = rdr.Read(entry.Delim[:])
+		n, err = io.ReadFull(rdr, entry.Delim[:])
 		read += n
 		if err != nil {
-			panic(err)
+			return ret, errors.New("Bad tree file: truncated entry")
 		}
 
 		str, n := readNullTerminated(rdr)
 		read += n
+		//tree modes are only 5 digits ("40000"), so the space has gone into the mode and the delim is really the start of the name
+		if entry.Mode[5] == ' ' {
+			str = string(entry.Delim[:]) + str
+			entry.Delim[0] = ' '
+		}
 		entry.Name = str
 
-		n, err = rdr.Read(entry.Hash[:])
+		n, err = io.ReadFull(rdr, entry.Hash[:])
 		read += n
 		if err != nil {
-			panic(err)
+			return ret, errors.New("Bad tree file: truncated entry")
 		}
 
 		ret = append(ret, entry)
 	}
 
-	return ret
+	return ret, nil
 }
 
 func readNullTerminated(rdr io.Reader) (string, int) {
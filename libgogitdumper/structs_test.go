@@ -0,0 +1,107 @@
+package libgogitdumper
+
+import (
+	"bytes"
+	"encoding/hex"
+	"strconv"
+	"testing"
+)
+
+// treeObject builds a decompressed tree object out of mode, name and hex sha1 triples
+func treeObject(entries ...[3]string) []byte {
+	body := &bytes.Buffer{}
+	for _, x := range entries {
+		sha, _ := hex.DecodeString(x[2])
+		body.WriteString(x[0] + " " + x[1] + "\x00")
+		body.Write(sha)
+	}
+	return append([]byte("tree "+strconv.Itoa(body.Len())+"\x00"), body.Bytes()...)
+}
+
+func TestParseTreeFile(t *testing.T) {
+	tree, err := ParseTreeFile(treeObject(
+		[3]string{"100644", "README", mainSha},
+		[3]string{"100755", "run.sh", tagSha},
+		[3]string{"40000", "src", peelSha},
+	))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(tree.TreeEntries) != 3 || hex.EncodeToString(tree.TreeEntries[1].Hash[:]) != tagSha {
+		t.Errorf("got %+v", tree.TreeEntries)
+	}
+	//subdirectories have a shorter mode
+	if x := tree.TreeEntries[2]; x.Name != "src" || !x.IsTree() || tree.TreeEntries[0].IsTree() {
+		t.Errorf("got %+v", tree.TreeEntries[2])
+	}
+
+	//all of these come off the server, none of them should panic
+	good := treeObject([3]string{"100644", "README", mainSha})
+	bad := map[string][]byte{
+		"not a tree": []byte("blob 3\x00abc"),
+		"bad length": []byte("tree zz\x00"),
+		"truncated":  good[:len(good)-5],
+		"too long":   append([]byte("tree 999\x00"), good[len("tree 33\x00"):]...),
+		"empty":      {},
+	}
+	for name, b := range bad {
+		if _, err := ParseTreeFile(b); err == nil {
+			t.Errorf("%s: expected an error", name)
+		}
+	}
+}
+
+func TestParseIndexFileBad(t *testing.T) {
+	//a header claiming more entries than there are bytes for, and entries with name lengths running off the end
+	entry := make([]byte, 70)
+	entry[60], entry[61] = 0x0f, 0xfe
+	bad := map[string][]byte{
+		"empty":         {},
+		"short header":  []byte("DIRC\x00\x00"),
+		"long name":     append([]byte("DIRC\x00\x00\x00\x02\x00\x00\x00\x01"), entry...),
+		"wrong version": []byte("DIRC\x00\x00\x00\x09\x00\x00\x00\x00"),
+	}
+	for name, b := range bad {
+		if _, err := ParseIndexFile(b); err == nil {
+			t.Errorf("%s: expected an error", name)
+		}
+	}
+}
+
+func TestNoteTargets(t *testing.T) {
+	const noteSha = "4444444444444444444444444444444444444444"
+	flat, _ := ParseTreeFile(treeObject(
+		[3]string{"100644", mainSha, noteSha},
+		[3]string{"100644", "README", noteSha},
+	))
+	targets, subtrees := NoteTargets(flat, "")
+	if len(targets) != 1 || targets[0] != mainSha || len(subtrees) != 0 {
+		t.Errorf("flat: got %v %v", targets, subtrees)
+	}
+
+	//11/111.../ with a second level of fanout under 22/
+	top, _ := ParseTreeFile(treeObject(
+		[3]string{"40000", "11", peelSha},
+		[3]string{"40000", "22", noteSha},
+		[3]string{"40000", "docs", noteSha},
+	))
+	targets, subtrees = NoteTargets(top, "")
+	if len(targets) != 0 || len(subtrees) != 2 || subtrees[peelSha] != "11" {
+		t.Fatalf("top: got %v %v", targets, subtrees)
+	}
+	mid, _ := ParseTreeFile(treeObject([3]string{"40000", "22", noteSha}))
+	targets, subtrees = NoteTargets(mid, "22")
+	if len(targets) != 0 || subtrees[noteSha] != "2222" {
+		t.Fatalf("mid: got %v %v", targets, subtrees)
+	}
+	leaf, _ := ParseTreeFile(treeObject(
+		[3]string{"100644", mainSha[2:], noteSha},
+		[3]string{"100644", "not-a-note", noteSha},
+	))
+	if targets, _ = NoteTargets(leaf, "11"); len(targets) != 1 || targets[0] != mainSha {
+		t.Errorf("leaf: got %v", targets)
+	}
+	if targets, _ = NoteTargets(leaf, ""); len(targets) != 0 {
+		t.Errorf("leaf without its prefix: got %v", targets)
+	}
+}
@@ -29,3 +29,13 @@ func (t *ThreadSafeSet) Add(s string) {
 	t.vals[s] = true
 
 }
+
+func (t ThreadSafeSet) Values() []string {
+	t.mutex.RLock()
+	defer t.mutex.RUnlock()
+	ret := make([]string, 0, len(t.vals))
+	for k := range t.vals {
+		ret = append(ret, k)
+	}
+	return ret
+}
@@ -0,0 +1,166 @@
+package libgogitdumper
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"strings"
+
+	"software.sslmate.com/src/go-pkcs12"
+)
+
+var tlsVersions = map[string]uint16{
+	"1.0": tls.VersionTLS10,
+	"1.1": tls.VersionTLS11,
+	"1.2": tls.VersionTLS12,
+	"1.3": tls.VersionTLS13,
+}
+
+// BuildTLSConfig makes the tls config for the transport: client certs (PEM or PKCS#12), a CA bundle to trust instead of the system roots,
+// and the allowed TLS versions. The SNI override is left to SNIDialer, as it only applies to the target hosts.
+func BuildTLSConfig(cfg Config, insecure bool) (*tls.Config, error) {
+	ret := &tls.Config{InsecureSkipVerify: insecure}
+
+	if cfg.CertFile != "" && cfg.PKCS12File != "" {
+		return nil, errors.New("use either a PEM cert or a PKCS#12 file, not both")
+	}
+	if cfg.CertFile != "" {
+		keyFile := cfg.KeyFile
+		if keyFile == "" {
+			//key and cert bundled in the one file
+			keyFile = cfg.CertFile
+		}
+		cert, err := tls.LoadX509KeyPair(cfg.CertFile, keyFile)
+		if err != nil {
+			return nil, fmt.Errorf("loading client cert: %v", err)
+		}
+		ret.Certificates = []tls.Certificate{cert}
+	}
+	if cfg.PKCS12File != "" {
+		cert, err := loadPKCS12(cfg.PKCS12File, cfg.PKCS12Password)
+		if err != nil {
+			return nil, fmt.Errorf("loading PKCS#12 file: %v", err)
+		}
+		ret.Certificates = []tls.Certificate{cert}
+	}
+
+	if cfg.CAFile != "" {
+		b, err := os.ReadFile(cfg.CAFile)
+		if err != nil {
+			return nil, err
+		}
+		//only the given CAs are trusted, not the system ones
+		ret.RootCAs = x509.NewCertPool()
+		if !ret.RootCAs.AppendCertsFromPEM(b) {
+			return nil, fmt.Errorf("no PEM certificates found in %s", cfg.CAFile)
+		}
+	}
+
+	for _, x := range []struct {
+		s string
+		v *uint16
+	}{{cfg.TLSMin, &ret.MinVersion}, {cfg.TLSMax, &ret.MaxVersion}} {
+		if x.s == "" {
+			continue
+		}
+		v, ok := tlsVersions[x.s]
+		if !ok {
+			return nil, fmt.Errorf("unknown TLS version %q (1.0, 1.1, 1.2 or 1.3)", x.s)
+		}
+		*x.v = v
+	}
+	if ret.MinVersion != 0 && ret.MaxVersion != 0 && ret.MinVersion > ret.MaxVersion {
+		return nil, errors.New("minimum TLS version is above the maximum")
+	}
+	return ret, nil
+}
+
+// serverName picks the name for SNI and cert verification: -sni if given, otherwise the Host override, so the handshake matches the vhost being asked for.
+// Empty means the url's host, which is what net/http does by default.
+func serverName(cfg Config) string {
+	host := cfg.SNI
+	if host == "" {
+		host = cfg.Host
+	}
+	for _, x := range cfg.Headers {
+		if name, value, ok := strings.Cut(x, ":"); host == "" && ok && strings.EqualFold(strings.TrimSpace(name), "Host") {
+			host = strings.TrimSpace(value)
+		}
+	}
+	if h, _, err := net.SplitHostPort(host); err == nil {
+		host = h
+	}
+	return strings.TrimSuffix(strings.TrimPrefix(host, "["), "]")
+}
+
+// SNIDialer does the TLS handshake itself, so that the SNI override (and the name the cert is checked against) is only used for the target hosts.
+// Anything else (a host a target redirects to, an https proxy, the other targets in -U mode) gets its own name, the way net/http would do it.
+// Connections tunnelled through an http proxy are handshaked by net/http, so they always use the url's host.
+type SNIDialer struct {
+	Config     *tls.Config
+	ServerName string
+	Hosts      map[string]bool //host:port of the targets
+}
+
+// NewSNIDialer returns nil if there's no -sni or Host override to apply, in which case net/http's own dialing does the right thing
+func NewSNIDialer(config *tls.Config, cfg Config, targets []string) *SNIDialer {
+	name := serverName(cfg)
+	if name == "" {
+		return nil
+	}
+	return &SNIDialer{Config: config, ServerName: name, Hosts: targetHosts(targets)}
+}
+
+// DialTLSContext makes a DialTLSContext for a transport that connects with dial
+func (s *SNIDialer) DialTLSContext(dial func(ctx context.Context, network, addr string) (net.Conn, error)) func(ctx context.Context, network, addr string) (net.Conn, error) {
+	if dial == nil {
+		dial = (&net.Dialer{}).DialContext
+	}
+	return func(ctx context.Context, network, addr string) (net.Conn, error) {
+		conn, err := dial(ctx, network, addr)
+		if err != nil {
+			return nil, err
+		}
+		config := s.Config.Clone()
+		config.ServerName = s.serverNameFor(addr)
+		tc := tls.Client(conn, config)
+		if err := tc.HandshakeContext(ctx); err != nil {
+			conn.Close()
+			return nil, err
+		}
+		return tc, nil
+	}
+}
+
+// serverNameFor gives the override for target hosts, and the host itself for anything else
+func (s *SNIDialer) serverNameFor(addr string) string {
+	if s.Hosts[strings.ToLower(addr)] {
+		return s.ServerName
+	}
+	host, _, err := net.SplitHostPort(addr)
+	if err != nil {
+		host = addr
+	}
+	return host
+}
+
+// loadPKCS12 keeps any CA certs in the file as the rest of the chain, for servers that want it sent
+func loadPKCS12(path, password string) (tls.Certificate, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return tls.Certificate{}, err
+	}
+	key, cert, chain, err := pkcs12.DecodeChain(b, password)
+	if err != nil {
+		return tls.Certificate{}, err
+	}
+	ret := tls.Certificate{PrivateKey: key, Leaf: cert, Certificate: [][]byte{cert.Raw}}
+	for _, x := range chain {
+		ret.Certificate = append(ret.Certificate, x.Raw)
+	}
+	return ret, nil
+}
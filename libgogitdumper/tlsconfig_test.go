@@ -0,0 +1,83 @@
+package libgogitdumper
+
+import (
+	"crypto/tls"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+)
+
+// sniServer records the server name each handshake asked for. The httptest cert is valid for example.com and 127.0.0.1.
+func sniServer(seen *[]string, mutex *sync.Mutex) *httptest.Server {
+	ts := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, "ok")
+	}))
+	ts.TLS = &tls.Config{GetConfigForClient: func(hello *tls.ClientHelloInfo) (*tls.Config, error) {
+		mutex.Lock()
+		*seen = append(*seen, hello.ServerName)
+		mutex.Unlock()
+		return nil, nil
+	}}
+	ts.StartTLS()
+	return ts
+}
+
+func TestSNIDialer(t *testing.T) {
+	var targetSNI, otherSNI []string
+	mutex := &sync.Mutex{}
+	target := sniServer(&targetSNI, mutex)
+	defer target.Close()
+	other := sniServer(&otherSNI, mutex)
+	defer other.Close()
+
+	base := target.Client().Transport.(*http.Transport)
+	tlsConfig := base.TLSClientConfig.Clone() //trusts the httptest CA
+	cfg := Config{Host: "example.com:443"}
+	sni := NewSNIDialer(tlsConfig, cfg, []string{target.URL + "/.git/"})
+	if sni == nil {
+		t.Fatal("no dialer for a Host override")
+	}
+	tr := &http.Transport{TLSClientConfig: tlsConfig}
+	tr.DialTLSContext = sni.DialTLSContext(nil)
+	client := &http.Client{Transport: tr}
+
+	for _, u := range []string{target.URL, other.URL} {
+		resp, err := client.Get(u)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+	}
+	if len(targetSNI) != 1 || targetSNI[0] != "example.com" {
+		t.Errorf("target got SNI %q, want example.com", targetSNI)
+	}
+	//ip addresses aren't sent as SNI, so anything but the override comes through empty
+	if len(otherSNI) != 1 || otherSNI[0] != "" {
+		t.Errorf("other host got SNI %q, want its own name", otherSNI)
+	}
+
+	if NewSNIDialer(tlsConfig, Config{}, []string{target.URL}) != nil {
+		t.Error("dialer made with nothing to override")
+	}
+}
+
+func TestServerName(t *testing.T) {
+	tests := []struct {
+		cfg  Config
+		want string
+	}{
+		{Config{}, ""},
+		{Config{SNI: "sni.example"}, "sni.example"},
+		{Config{Host: "vhost.example:8443"}, "vhost.example"},
+		{Config{SNI: "sni.example", Host: "vhost.example"}, "sni.example"},
+		{Config{Headers: []string{"host: header.example"}}, "header.example"},
+		{Config{Host: "[::1]:443"}, "::1"},
+	}
+	for _, tt := range tests {
+		if got := serverName(tt.cfg); got != tt.want {
+			t.Errorf("%+v: got %q, want %q", tt.cfg, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,75 @@
+package libgogitdumper
+
+import (
+	"encoding/xml"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strings"
+)
+
+const propfindBody = `<?xml version="1.0" encoding="utf-8"?><D:propfind xmlns:D="DAV:"><D:prop><D:resourcetype/></D:prop></D:propfind>`
+
+type davMultistatus struct {
+	XMLName   xml.Name `xml:"multistatus"`
+	Responses []struct {
+		Href     string `xml:"href"`
+		Propstat []struct {
+			Prop struct {
+				ResourceType struct {
+					Collection *struct{} `xml:"collection"`
+				} `xml:"resourcetype"`
+			} `xml:"prop"`
+		} `xml:"propstat"`
+	} `xml:"response"`
+}
+
+// PropfindListing lists a directory using a WebDAV PROPFIND (Depth: 1), for servers that have autoindex off but DAV on
+func PropfindListing(dirURL string, client *http.Client) ([]string, error) {
+	request, err := http.NewRequest("PROPFIND", dirURL, strings.NewReader(propfindBody))
+	if err != nil {
+		return nil, err
+	}
+	request.Header.Set("Depth", "1")
+	request.Header.Set("Content-Type", "application/xml; charset=utf-8")
+	resp, err := client.Do(request)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != 207 {
+		return nil, fmt.Errorf("PROPFIND error code: %d", resp.StatusCode)
+	}
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+
+	ms := davMultistatus{}
+	if err := xml.Unmarshal(body, &ms); err != nil {
+		return nil, err
+	}
+	hrefs := []string{}
+	for _, x := range ms.Responses {
+		href := x.Href
+		isDir := false
+		for _, p := range x.Propstat {
+			if p.Prop.ResourceType.Collection != nil {
+				isDir = true
+			}
+		}
+		if isDir && !strings.HasSuffix(href, "/") {
+			href += "/"
+		}
+		hrefs = append(hrefs, href)
+	}
+
+	//the directory itself is always in the response
+	ret := []string{}
+	for _, x := range resolveHrefs(dirURL, hrefs) {
+		if x != dirURL {
+			ret = append(ret, x)
+		}
+	}
+	return ret, nil
+}